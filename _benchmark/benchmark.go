@@ -101,6 +101,18 @@ static int check3(unsigned char *data) {
   }
   return -1;
 }
+
+// decode_frame imitates a decoder: writes the whole output buffer then reads it back.
+static unsigned long decode_frame(unsigned char *dst, size_t size, unsigned char seed) {
+  for (size_t i = 0; i < size; i += 1) {
+    dst[i] = (unsigned char) (seed + i);
+  }
+  unsigned long sum = 0;
+  for (size_t i = 0; i < size; i += 64) {
+    sum += dst[i];
+  }
+  return sum;
+}
 */
 import "C"
 
@@ -455,3 +467,9 @@ func benchmarkCBytes_cgobytepool(p cgobytepool.Pool) {
 		panic("err")
 	}
 }
+
+func benchmarkDecode(p cgobytepool.Pool, size int) {
+	ptr := p.Get(size)
+	C.decode_frame((*C.uchar)(ptr), C.size_t(size), 1)
+	p.Put(ptr, size)
+}
@@ -1,7 +1,11 @@
 package benchmark
 
 import (
+	"fmt"
+	"runtime"
+	"runtime/cgo"
 	"testing"
+	"unsafe"
 
 	"github.com/octu0/bp"
 
@@ -176,3 +180,152 @@ func BenchmarkCgoBytePool(b *testing.B) {
 		})
 	})
 }
+
+type wrapPool struct {
+	cgobytepool.Pool
+}
+
+func BenchmarkHandle(b *testing.B) {
+	newPool := func() *cgobytepool.CgoBytePool {
+		return cgobytepool.NewPool(
+			cgobytepool.DefaultMemoryAlignmentFunc,
+			cgobytepool.WithPoolSize(1000, 16*1024),
+			cgobytepool.WithPoolSize(1000, 4*1024),
+			cgobytepool.WithPoolSize(1000, 512),
+		)
+	}
+	b.Run("cgo.Handle", func(tb *testing.B) {
+		p := newPool()
+		h := cgo.NewHandle(p)
+		defer h.Delete()
+
+		ctx := unsafe.Pointer(&h)
+		tb.ResetTimer()
+		tb.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				pp := (*(*cgo.Handle)(ctx)).Value().(cgobytepool.Pool)
+				ptr := pp.Get(512)
+				pp = (*(*cgo.Handle)(ctx)).Value().(cgobytepool.Pool)
+				pp.Put(ptr, 512)
+			}
+		})
+	})
+	b.Run("registry", func(tb *testing.B) {
+		p := newPool()
+		h := cgobytepool.CgoHandle(p)
+		defer h.Release()
+
+		ctx := unsafe.Pointer(&h)
+		tb.ResetTimer()
+		tb.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ptr := cgobytepool.HandlePoolGet(ctx, 512)
+				cgobytepool.HandlePoolPut(ctx, ptr, 512)
+			}
+		})
+	})
+	b.Run("registry_byvalue", func(tb *testing.B) {
+		p := newPool()
+		h := cgobytepool.CgoHandle(p)
+		defer h.Release()
+
+		tb.ResetTimer()
+		tb.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ptr := cgobytepool.HandlePoolGetByValue(uintptr(h), 512)
+				cgobytepool.HandlePoolPutByValue(uintptr(h), ptr, 512)
+			}
+		})
+	})
+	b.Run("registry_interface", func(tb *testing.B) {
+		p := newPool()
+		h := cgobytepool.CgoHandle(wrapPool{p})
+		defer h.Release()
+
+		ctx := unsafe.Pointer(&h)
+		tb.ResetTimer()
+		tb.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ptr := cgobytepool.HandlePoolGet(ctx, 512)
+				cgobytepool.HandlePoolPut(ctx, ptr, 512)
+			}
+		})
+	})
+}
+
+func BenchmarkFreelist(b *testing.B) {
+	newPool := func(lifo bool, size int) *cgobytepool.CgoBytePool {
+		poolSize := 256
+		funcs := []cgobytepool.WithPoolFunc{cgobytepool.WithPoolSize(poolSize, size)}
+		if lifo {
+			funcs = []cgobytepool.WithPoolFunc{cgobytepool.WithLIFOPoolSize(poolSize, size)}
+		}
+		p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc, funcs...)
+		p.Warm(poolSize, size) // FIFO cycles through all idle buffers
+		return p
+	}
+
+	for _, size := range []int{16 * 1024, 64 * 1024} {
+		for _, policy := range []struct {
+			name string
+			lifo bool
+		}{
+			{"fifo", false},
+			{"lifo", true},
+		} {
+			b.Run(fmt.Sprintf("%s/%dKB", policy.name, size/1024), func(tb *testing.B) {
+				p := newPool(policy.lifo, size)
+				defer p.Close()
+
+				tb.SetBytes(int64(size))
+				tb.ResetTimer()
+				for i := 0; i < tb.N; i += 1 {
+					benchmarkDecode(p, size)
+				}
+			})
+			b.Run(fmt.Sprintf("%s/%dKB/parallel", policy.name, size/1024), func(tb *testing.B) {
+				p := newPool(policy.lifo, size)
+				defer p.Close()
+
+				tb.SetBytes(int64(size))
+				tb.ResetTimer()
+				tb.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						benchmarkDecode(p, size)
+					}
+				})
+			})
+		}
+	}
+}
+
+func BenchmarkFreelistContention(b *testing.B) {
+	const size = 4 * 1024
+
+	withPoolSize := map[string]func(int, int) cgobytepool.WithPoolFunc{
+		"fifo":    cgobytepool.WithPoolSize,
+		"lifo":    cgobytepool.WithLIFOPoolSize,
+		"sharded": cgobytepool.WithShardedPoolSize,
+	}
+
+	for _, procs := range []int{1, 2, 4, 8, 16, 32, 64} {
+		for _, name := range []string{"fifo", "lifo", "sharded"} {
+			b.Run(fmt.Sprintf("%s/procs%d", name, procs), func(tb *testing.B) {
+				defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs)) // before NewPool, shards follow GOMAXPROCS
+
+				poolSize := 1024
+				p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc, withPoolSize[name](poolSize, size))
+				defer p.Close()
+				p.Warm(poolSize, size)
+
+				tb.ResetTimer()
+				tb.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						ptr := p.Get(size)
+						p.Put(ptr, size)
+					}
+				})
+			})
+		}
+	}
+}
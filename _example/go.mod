@@ -1,6 +1,6 @@
 module github.com/octu0/cgobytepool/benchmark
 
-go 1.19
+go 1.21
 
 require github.com/octu0/cgobytepool v0.0.0
 
@@ -0,0 +1,163 @@
+package cgobytepool
+
+/*
+#include <stdlib.h>
+
+#if defined(__APPLE__)
+#include <malloc/malloc.h>
+static size_t cgobytepool_usable_size(void *ptr) {
+  return malloc_size(ptr);
+}
+#elif defined(__linux__)
+#include <malloc.h>
+static size_t cgobytepool_usable_size(void *ptr) {
+  return malloc_usable_size(ptr);
+}
+#else
+static size_t cgobytepool_usable_size(void *ptr) {
+  return 0;
+}
+#endif
+
+// unlike C.malloc of cgo, it returns NULL on failure instead of abort
+static void *cgobytepool_malloc(size_t size) {
+  return malloc(size);
+}
+
+static void *cgobytepool_aligned_alloc(size_t alignment, size_t size) {
+  void *ptr = NULL;
+  if (posix_memalign(&ptr, alignment, size) != 0) {
+    return NULL;
+  }
+  return ptr;
+}
+*/
+import "C"
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// Allocator is backing memory allocator of pool.
+// Alloc returns nil when memory cannot be allocated.
+type Allocator interface {
+	Alloc(size int) unsafe.Pointer
+	Free(ptr unsafe.Pointer, size int)
+}
+
+// UsableSizer is implemented by Allocator that can report the actual usable size of ptr.
+type UsableSizer interface {
+	UsableSize(ptr unsafe.Pointer) int
+}
+
+var (
+	_ Allocator   = (*mallocAllocator)(nil)
+	_ UsableSizer = (*mallocAllocator)(nil)
+	_ Allocator   = (*alignedAllocator)(nil)
+	_ UsableSizer = (*alignedAllocator)(nil)
+	_ Allocator   = (*goAllocator)(nil)
+	_ UsableSizer = (*goAllocator)(nil)
+)
+
+var (
+	defaultAllocator Allocator = NewMallocAllocator()
+)
+
+type mallocAllocator struct{}
+
+func (mallocAllocator) Alloc(size int) unsafe.Pointer {
+	return C.cgobytepool_malloc(C.size_t(size))
+}
+
+func (mallocAllocator) Free(ptr unsafe.Pointer, size int) {
+	C.free(ptr)
+}
+
+func (mallocAllocator) UsableSize(ptr unsafe.Pointer) int {
+	return int(C.cgobytepool_usable_size(ptr))
+}
+
+// NewMallocAllocator returns allocator using libc malloc/free, which is default.
+// Alloc returns nil if malloc fails.
+func NewMallocAllocator() Allocator {
+	return mallocAllocator{}
+}
+
+type alignedAllocator struct {
+	alignment int
+}
+
+func (a alignedAllocator) Alloc(size int) unsafe.Pointer {
+	return unsafe.Pointer(C.cgobytepool_aligned_alloc(C.size_t(a.alignment), C.size_t(size)))
+}
+
+func (alignedAllocator) Free(ptr unsafe.Pointer, size int) {
+	C.free(ptr)
+}
+
+func (alignedAllocator) UsableSize(ptr unsafe.Pointer) int {
+	return int(C.cgobytepool_usable_size(ptr))
+}
+
+// NewAlignedAllocator returns allocator using posix_memalign, alignment must be
+// a power of 2 and a multiple of pointer size (e.g. 64 for cache line, 4096 for page).
+func NewAlignedAllocator(alignment int) Allocator {
+	return alignedAllocator{alignment}
+}
+
+type goBuffer struct {
+	buf    []byte
+	pinner *runtime.Pinner
+}
+
+type goAllocator struct {
+	mutex *sync.Mutex
+	bufs  map[uintptr]goBuffer
+}
+
+func (a *goAllocator) Alloc(size int) unsafe.Pointer {
+	if size <= 0 {
+		size = 1
+	}
+	buf := make([]byte, size)
+	pinner := new(runtime.Pinner)
+	pinner.Pin(&buf[0])
+
+	ptr := unsafe.Pointer(&buf[0])
+	a.mutex.Lock()
+	a.bufs[uintptr(ptr)] = goBuffer{buf, pinner}
+	a.mutex.Unlock()
+	return ptr
+}
+
+func (a *goAllocator) Free(ptr unsafe.Pointer, size int) {
+	a.mutex.Lock()
+	b, ok := a.bufs[uintptr(ptr)]
+	delete(a.bufs, uintptr(ptr))
+	a.mutex.Unlock()
+
+	if ok {
+		b.pinner.Unpin()
+	}
+}
+
+func (a *goAllocator) UsableSize(ptr unsafe.Pointer) int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if b, ok := a.bufs[uintptr(ptr)]; ok {
+		return len(b.buf)
+	}
+	return 0
+}
+
+// NewGoAllocator returns allocator using Go heap.
+// Buffers are pinned (runtime.Pinner) until Free, so they can be passed to C.
+func NewGoAllocator() Allocator {
+	return &goAllocator{
+		mutex: new(sync.Mutex),
+		bufs:  make(map[uintptr]goBuffer),
+	}
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package cgobytepool
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	_ Allocator = (*mmapAllocator)(nil)
+)
+
+type mmapAllocator struct{}
+
+func (mmapAllocator) Alloc(size int) unsafe.Pointer {
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil
+	}
+	return unsafe.Pointer(&b[0])
+}
+
+func (mmapAllocator) Free(ptr unsafe.Pointer, size int) {
+	syscall.Munmap(unsafe.Slice((*byte)(ptr), size))
+}
+
+// NewMmapAllocator returns allocator that maps anonymous pages for each buffer,
+// suitable for large buffers that should be returned to the OS on Free.
+func NewMmapAllocator() Allocator {
+	return mmapAllocator{}
+}
@@ -0,0 +1,86 @@
+package cgobytepool
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"unsafe"
+)
+
+func TestAllocator(t *testing.T) {
+	testAllocator := func(tt *testing.T, a Allocator) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 100), WithAllocator(a))
+		defer p.Close()
+
+		ptr1 := p.Get(100)
+		ptr2 := p.Get(4096) // fallback
+		if ptr1 == nil || ptr2 == nil {
+			tt.Fatalf("must alloc")
+		}
+		data1 := unsafe.Slice((*byte)(ptr1), 100)
+		data2 := unsafe.Slice((*byte)(ptr2), 4096)
+		for i := range data1 {
+			data1[i] = 123
+		}
+		for i := range data2 {
+			data2[i] = 234
+		}
+		if us, ok := a.(UsableSizer); ok {
+			if us.UsableSize(ptr1) < 100 {
+				tt.Errorf("usable size actual=%d", us.UsableSize(ptr1))
+			}
+		}
+		p.Put(ptr1, 100)
+		p.Put(ptr2, 4096)
+
+		ptr3 := p.Get(100) // reuse
+		if ptr1 != ptr3 {
+			tt.Errorf("reuse buffer")
+		}
+		p.Put(ptr3, 100)
+		if p.TotalAllocBytes() != 352 {
+			tt.Errorf("actual=%d", p.TotalAllocBytes())
+		}
+	}
+	t.Run("malloc", func(tt *testing.T) {
+		testAllocator(tt, NewMallocAllocator())
+	})
+	t.Run("malloc_failed", func(tt *testing.T) {
+		if ptr := NewMallocAllocator().Alloc(math.MaxInt); ptr != nil {
+			tt.Fatalf("expect nil actual=%p", ptr)
+		}
+
+		p := NewPool(DefaultMemoryAlignmentFunc)
+		defer p.Close()
+
+		if _, err := p.TryGet(math.MaxInt); errors.Is(err, ErrAllocFailed) != true {
+			tt.Errorf("expect ErrAllocFailed actual=%+v", err)
+		}
+	})
+	t.Run("aligned", func(tt *testing.T) {
+		a := NewAlignedAllocator(4096)
+		testAllocator(tt, a)
+
+		ptr := a.Alloc(100)
+		defer a.Free(ptr, 100)
+		if uintptr(ptr)%4096 != 0 {
+			tt.Errorf("aligned %p", ptr)
+		}
+	})
+	t.Run("mmap", func(tt *testing.T) {
+		testAllocator(tt, NewMmapAllocator())
+	})
+	t.Run("go", func(tt *testing.T) {
+		a := NewGoAllocator()
+		testAllocator(tt, a)
+
+		ptr := a.Alloc(100)
+		if a.(UsableSizer).UsableSize(ptr) != 100 {
+			tt.Errorf("actual=%d", a.(UsableSizer).UsableSize(ptr))
+		}
+		a.Free(ptr, 100)
+		if a.(UsableSizer).UsableSize(ptr) != 0 {
+			tt.Errorf("freed")
+		}
+	})
+}
@@ -1,16 +1,16 @@
 package cgobytepool
 
-/*
-#include <stdlib.h>
-*/
-import "C"
-
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"runtime"
-	"runtime/cgo"
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -25,6 +25,17 @@ type PoolStats struct {
 		ID   int
 		Size int64
 	}
+	Outstanding struct {
+		Count     int64 // buffers taken by Get and not yet returned by Put
+		Fallbacks int64 // of which allocated outside of size classes
+	}
+	Counters struct {
+		Gets    int64
+		Puts    int64
+		Mallocs int64 // calls of Allocator.Alloc
+		Frees   int64 // calls of Allocator.Free
+	}
+	Closed bool
 }
 
 type Pool interface {
@@ -35,36 +46,155 @@ type Pool interface {
 	Stats() PoolStats
 }
 
-func HandlePoolGet(ctx unsafe.Pointer, size int) unsafe.Pointer {
-	h := *(*cgo.Handle)(ctx)
+type MemoryAligmentFunc func(int) int
+
+type freelistKind int
+
+const (
+	freelistFIFO freelistKind = iota
+	freelistLIFO
+	freelistSharded
+)
+
+type optPoolSize struct {
+	poolSize   int
+	bufferSize int
+	freelist   freelistKind
+}
 
-	p := h.Value().(Pool)
-	return p.Get(size)
+type optPool struct {
+	sizes            []optPoolSize
+	scavengeInterval time.Duration
+	scavengeIdleTTL  time.Duration
+	budget           int64
+	allocator        Allocator
+	profileRate      int
+	runtimeTrace     bool
+	observers        []Observer
+	name             string
+	recorder         io.Writer
+	prealloc         []optPoolSize
+	prefault         bool
+	warmupPath       string
+	warmupMaxAge     time.Duration
 }
 
-func HandlePoolPut(ctx unsafe.Pointer, data unsafe.Pointer, size int) {
-	h := *(*cgo.Handle)(ctx)
+type WithPoolFunc func(*optPool)
 
-	p := h.Value().(Pool)
-	p.Put(data, size)
+func WithPoolSize(poolSize, bufferSize int) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.sizes = append(opt.sizes, optPoolSize{poolSize: poolSize, bufferSize: bufferSize, freelist: freelistFIFO})
+	}
 }
 
-func HandlePoolFree(ctx unsafe.Pointer) {
-	h := *(*cgo.Handle)(ctx)
-	h.Delete()
+// WithLIFOPoolSize is same as WithPoolSize, but the class reuses the most recently returned buffer first.
+// It is likely still in CPU cache, at the cost of a mutex instead of a channel.
+func WithLIFOPoolSize(poolSize, bufferSize int) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.sizes = append(opt.sizes, optPoolSize{poolSize: poolSize, bufferSize: bufferSize, freelist: freelistLIFO})
+	}
 }
 
-func CgoHandle(p Pool) cgo.Handle {
-	return cgo.NewHandle(p)
+// WithScavenger starts a background goroutine that wakes up every interval and
+// frees the buffers that stayed unused in a freelist for at least idleTTL.
+func WithScavenger(interval, idleTTL time.Duration) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.scavengeInterval = interval
+		opt.scavengeIdleTTL = idleTTL
+	}
 }
 
-type MemoryAligmentFunc func(int) int
+// WithMemoryBudget limits the memory retained by the pool: once TotalAllocBytes
+// exceeds budget, returned buffers are freed instead of being kept for reuse.
+func WithMemoryBudget(budget int64) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.budget = budget
+	}
+}
 
-type WithPoolFunc func(MemoryAligmentFunc) *cmallocPool
+// WithAllocator replaces the backing allocator (libc malloc by default).
+func WithAllocator(a Allocator) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.allocator = a
+	}
+}
 
-func WithPoolSize(poolSize, bufferSize int) WithPoolFunc {
-	return func(fn MemoryAligmentFunc) *cmallocPool {
-		return newCMallocPool(poolSize, fn(bufferSize))
+// WithProfileRate records the stack of Get for 1 in rate bytes in the "cgobytepool" pprof profile
+// (see Profile), so that outstanding buffers can be inspected with go tool pprof.
+// A rate of 0 disables profiling (default), 1 records every Get.
+func WithProfileRate(rate int) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.profileRate = rate
+	}
+}
+
+// WithRuntimeTrace emits runtime/trace regions and logs for fallback allocations, freelist misses,
+// overflow frees, CloseWait and scavenger runs. Without a running trace they cost a flag check.
+func WithRuntimeTrace() WithPoolFunc {
+	return func(opt *optPool) {
+		opt.runtimeTrace = true
+	}
+}
+
+// WithObserver registers o to receive pool events, it can be used multiple times.
+func WithObserver(o Observer) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.observers = append(opt.observers, o)
+	}
+}
+
+// WithName registers the pool in the global registry (see Lookup and Each) until Close.
+// NewPool panics if name is already registered, NewPoolFromConfig returns ErrDuplicateName.
+// A registered pool is referenced by the registry, so it must be closed explicitly.
+func WithName(name string) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.name = name
+	}
+}
+
+// WithRecorder records every Get and Put as compact binary events to w (read them with NewTraceReader),
+// for offline tuning with cmd/cgobytepool-replay. Events are buffered until FlushTrace or Close.
+func WithRecorder(w io.Writer) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.recorder = w
+	}
+}
+
+// WithShardedPoolSize is same as WithPoolSize, but the class keeps idle buffers in per-P local caches
+// and a shared depot instead of a single channel, to remove contention under heavy parallel load.
+// The total of idle buffers is still limited to poolSize.
+func WithShardedPoolSize(poolSize, bufferSize int) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.sizes = append(opt.sizes, optPoolSize{poolSize: poolSize, bufferSize: bufferSize, freelist: freelistSharded})
+	}
+}
+
+// WithPrealloc allocates n buffers of the size class serving bufferSize at NewPool,
+// up to the pool size of the class, so that the first Get does not malloc.
+// Arguments are in the same order as WithPoolSize.
+func WithPrealloc(n, bufferSize int) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.prealloc = append(opt.prealloc, optPoolSize{poolSize: n, bufferSize: bufferSize, freelist: freelistFIFO})
+	}
+}
+
+// WithPrefault touches every page of buffers allocated by WithPrealloc and Warm,
+// so that page faults happen before traffic arrives.
+func WithPrefault() WithPoolFunc {
+	return func(opt *optPool) {
+		opt.prefault = true
+	}
+}
+
+// WithWarmupProfile pre-warms each size class with the peak outstanding buffers saved in path
+// by the previous Close (or SaveWarmupProfile). If path is missing, invalid or older than maxAge
+// (0 means no limit), or a class is not in the profile, WithPrealloc is used instead for the class.
+// Each class saves max(peak, loaded peak/2), so that the profile shrinks gradually
+// over runs with lower peaks.
+func WithWarmupProfile(path string, maxAge time.Duration) WithPoolFunc {
+	return func(opt *optPool) {
+		opt.warmupPath = path
+		opt.warmupMaxAge = maxAge
 	}
 }
 
@@ -82,11 +212,40 @@ var (
 	_ Pool = (*CgoBytePool)(nil)
 )
 
+var (
+	pageSize = os.Getpagesize()
+)
+
+var (
+	ErrPoolClosed  = errors.New("cgobytepool: pool closed")
+	ErrAllocFailed = errors.New("cgobytepool: alloc failed")
+)
+
 type CgoBytePool struct {
-	pools     []*cmallocPool
-	bytes     int64
-	alignFunc MemoryAligmentFunc
-	fallbacks *sync.Map // map[uintptr]unsafe.Pointer
+	name       string
+	pools      []*cmallocPool
+	bytes      int64
+	budget     int64 // effective, the tightest of baseBudget and limits
+	budgets    *poolBudgets
+	alignFunc  MemoryAligmentFunc
+	allocator  Allocator
+	fallbacks  *sync.Map // map[uintptr]unsafe.Pointer
+	fbCount    int64
+	fbMallocs  int64
+	fbFrees    int64
+	gets       int64
+	puts       int64
+	getting    int64 // Get in progress, not counted as outstanding yet
+	profiler   *profiler
+	trace      bool
+	observer   Observer
+	recorder   *recorder
+	prefault   bool
+	warmupPath string
+	scavenger  *scavenger
+	closed     int32
+	drainOnce  *sync.Once
+	drained    chan struct{}
 }
 
 func (p *CgoBytePool) find(size int) (*cmallocPool, bool) {
@@ -110,36 +269,169 @@ func (p *CgoBytePool) reverseFind(size int) (*cmallocPool, bool) {
 	return nil, false
 }
 
+// Get returns buffer of at least size bytes, or nil if pool is closed or allocation fails (see TryGet).
 func (p *CgoBytePool) Get(size int) unsafe.Pointer {
+	ptr, _ := p.tryGet(size)
+	return ptr
+}
+
+// TryGet is same as Get but reports why no buffer is returned, the result is (nil, err) on failure:
+// ErrPoolClosed after Close, or ErrAllocFailed when the Allocator fails to allocate
+// a new buffer for a freelist miss or a size larger than every size class.
+func (p *CgoBytePool) TryGet(size int) (unsafe.Pointer, error) {
+	return p.tryGet(size)
+}
+
+func (p *CgoBytePool) tryGet(size int) (unsafe.Pointer, error) {
+	// counted before checking closed, so that a concurrent Close does not notify drained
+	// until the buffer of this Get is counted as outstanding
+	atomic.AddInt64(&p.getting, 1)
+	if p.isClosed() {
+		p.doneGet()
+		return nil, ErrPoolClosed
+	}
+
 	n := p.alignFunc(size)
+	ptr := unsafe.Pointer(nil)
+	class := FallbackClass
 	if pp, ok := p.find(n); ok {
-		return pp.Get()
+		ptr = pp.Get()
+		class = pp.id
+	} else {
+		ptr = p.fallbackGet(n)
+	}
+	p.doneGet()
+	if ptr == nil {
+		return nil, ErrAllocFailed
+	}
+	atomic.AddInt64(&p.gets, 1)
+	if p.profiler != nil {
+		p.profiler.add(ptr, n, 2) // caller of Get/TryGet
+	}
+	if p.observer != nil {
+		p.observer.OnGet(class, size, ptr)
+	}
+	if p.recorder != nil {
+		p.recorder.record(TraceOpGet, size, class, ptr)
 	}
-	return p.fallbackGet(n)
+	return ptr, nil
 }
 
 func (p *CgoBytePool) fallbackGet(n int) unsafe.Pointer {
+	region := traceStartRegion(p.trace, traceRegionFallback)
+	ptr := p.allocator.Alloc(n)
+	region.End()
+	if ptr == nil {
+		traceLog(p.trace, "fallback alloc failed size=%d", n)
+		return nil
+	}
+	traceLog(p.trace, "fallback size=%d", n)
+	if p.observer != nil {
+		p.observer.OnFallback(FallbackClass, n, ptr)
+		p.observer.OnMalloc(FallbackClass, n, ptr)
+	}
 	atomic.AddInt64(&p.bytes, int64(n))
-	ptr := unsafe.Pointer(C.malloc(C.size_t(n)))
+	atomic.AddInt64(&p.fbCount, 1)
+	atomic.AddInt64(&p.fbMallocs, 1)
 	p.fallbacks.Store(uintptr(ptr), ptr)
 	return ptr
 }
 
+// Put returns buffer to pool. After Close, the buffer is freed immediately.
 func (p *CgoBytePool) Put(b unsafe.Pointer, size int) {
+	if b == nil {
+		return // failed Get
+	}
+	atomic.AddInt64(&p.puts, 1)
+	if p.profiler != nil {
+		p.profiler.remove(b) // before b can be reused
+	}
+
 	n := p.alignFunc(size)
-	if pp, ok := p.find(n); ok {
-		pp.Put(b, n)
-		return
+	pp, ok := p.find(n)
+	if p.observer != nil || p.recorder != nil {
+		// before b can be reused
+		class := FallbackClass
+		if ok {
+			class = pp.id
+		}
+		if p.observer != nil {
+			p.observer.OnPut(class, size, b)
+		}
+		if p.recorder != nil {
+			p.recorder.record(TraceOpPut, size, class, b)
+		}
+	}
+	if ok {
+		if p.overBudget() {
+			pp.discard(b)
+		} else {
+			pp.Put(b, n)
+		}
+	} else {
+		p.fallbackPut(b, n)
+	}
+
+	if p.isClosed() {
+		p.notifyDrained()
+	}
+}
+
+func (p *CgoBytePool) doneGet() {
+	atomic.AddInt64(&p.getting, -1)
+	if p.isClosed() {
+		p.notifyDrained()
+	}
+}
+
+func (p *CgoBytePool) overBudget() bool {
+	budget := atomic.LoadInt64(&p.budget)
+	if budget <= 0 {
+		return false
 	}
-	p.fallbackPut(b, n)
+	return budget < p.TotalAllocBytes()
 }
 
 func (p *CgoBytePool) fallbackPut(b unsafe.Pointer, n int) {
 	if v, ok := p.fallbacks.LoadAndDelete(uintptr(b)); ok {
 		ptr := v.(unsafe.Pointer)
-		C.free(ptr)
+		if p.observer != nil {
+			p.observer.OnFree(FallbackClass, n, ptr)
+		}
+		p.allocator.Free(ptr, n)
 		atomic.AddInt64(&p.bytes, -1*int64(n))
+		atomic.AddInt64(&p.fbCount, -1)
+		atomic.AddInt64(&p.fbFrees, 1)
+	}
+}
+
+func (p *CgoBytePool) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
+
+// notifyDrained loads getting before outstanding: a Get in progress at that time
+// has counted its buffer as outstanding before it finishes, and later Get sees closed.
+func (p *CgoBytePool) notifyDrained() {
+	if atomic.LoadInt64(&p.getting) == 0 && p.OutstandingCount() == 0 {
+		p.drainOnce.Do(func() {
+			close(p.drained)
+		})
+	}
+}
+
+// Name returns the name given by WithName.
+func (p *CgoBytePool) Name() string {
+	return p.name
+}
+
+// OutstandingCount returns the number of buffers that are taken by Get and not yet returned.
+func (p *CgoBytePool) OutstandingCount() int64 {
+	total := int64(0)
+	for _, pp := range p.pools {
+		total += pp.Outstanding()
 	}
+	total += atomic.LoadInt64(&p.fbCount)
+	return total
 }
 
 func (p *CgoBytePool) Stats() PoolStats {
@@ -160,6 +452,17 @@ func (p *CgoBytePool) Stats() PoolStats {
 	}
 	ps.Fallback.ID = 0
 	ps.Fallback.Size = p.AllocBytes()
+	ps.Outstanding.Count = p.OutstandingCount()
+	ps.Outstanding.Fallbacks = atomic.LoadInt64(&p.fbCount)
+	ps.Counters.Gets = atomic.LoadInt64(&p.gets)
+	ps.Counters.Puts = atomic.LoadInt64(&p.puts)
+	ps.Counters.Mallocs = atomic.LoadInt64(&p.fbMallocs)
+	ps.Counters.Frees = atomic.LoadInt64(&p.fbFrees)
+	for _, pp := range p.pools {
+		ps.Counters.Mallocs += pp.Mallocs()
+		ps.Counters.Frees += pp.Frees()
+	}
+	ps.Closed = p.isClosed()
 	return ps
 }
 
@@ -176,11 +479,185 @@ func (p *CgoBytePool) TotalAllocBytes() int64 {
 	return total
 }
 
+func (p *CgoBytePool) idleBytes() int64 {
+	total := int64(0)
+	for _, pp := range p.pools {
+		total += int64(pp.Len()) * int64(pp.bufSize)
+	}
+	return total
+}
+
+type poolBudgets struct {
+	mutex  *sync.Mutex
+	base   int64
+	limits map[interface{}]int64 // CgroupWatcher or MemoryGovernor -> budget
+}
+
+// tightest returns the smallest positive budget, 0 if all are unlimited.
+func (b *poolBudgets) tightest() int64 {
+	budget := b.base
+	for _, limit := range b.limits {
+		if 0 < limit && (budget <= 0 || limit < budget) {
+			budget = limit
+		}
+	}
+	return budget
+}
+
+func newPoolBudgets(base int64) *poolBudgets {
+	return &poolBudgets{
+		mutex:  new(sync.Mutex),
+		base:   base,
+		limits: make(map[interface{}]int64),
+	}
+}
+
+// updateBudget applies fn to budgets and the tightest budget to the pool.
+func (p *CgoBytePool) updateBudget(fn func(*poolBudgets)) {
+	p.budgets.mutex.Lock()
+	defer p.budgets.mutex.Unlock()
+
+	fn(p.budgets)
+	budget := p.budgets.tightest()
+	atomic.StoreInt64(&p.budget, budget)
+	if 0 < budget {
+		p.TrimTo(budget)
+	}
+}
+
+// setBudgetLimit sets the budget of limiter, the pool uses the tightest of all limiters and SetMemoryBudget.
+func (p *CgoBytePool) setBudgetLimit(limiter interface{}, budget int64) {
+	p.updateBudget(func(b *poolBudgets) {
+		b.limits[limiter] = budget
+	})
+}
+
+func (p *CgoBytePool) clearBudgetLimit(limiter interface{}) {
+	p.updateBudget(func(b *poolBudgets) {
+		delete(b.limits, limiter)
+	})
+}
+
+// SetMemoryBudget changes the budget at runtime, trimming idle buffers when the
+// pool already exceeds it. A budget of 0 or less means unlimited.
+// While CgroupWatcher or MemoryGovernor is running, the tightest of their budgets and this one is used.
+func (p *CgoBytePool) SetMemoryBudget(budget int64) {
+	p.updateBudget(func(b *poolBudgets) {
+		b.base = budget
+	})
+}
+
+// MemoryBudget returns the budget in effect.
+func (p *CgoBytePool) MemoryBudget() int64 {
+	return atomic.LoadInt64(&p.budget)
+}
+
+// Warm allocates up to n idle buffers into the size class serving size, limited by the
+// free capacity of the class. It returns the number of buffers allocated, 0 for fallback sizes.
+func (p *CgoBytePool) Warm(n, size int) int {
+	if p.isClosed() {
+		return 0
+	}
+	pp, ok := p.find(p.alignFunc(size))
+	if ok != true {
+		return 0
+	}
+	return pp.warm(n, p.prefault)
+}
+
+// FlushTrace writes buffered events of WithRecorder, it returns the first write error.
+// Events of Put after Close stay buffered until FlushTrace is called again.
+func (p *CgoBytePool) FlushTrace() error {
+	if p.recorder == nil {
+		return nil
+	}
+	return p.recorder.flush()
+}
+
+// ResetCounters zeroes PoolStats.Counters, outstanding buffers and allocated bytes are kept.
+func (p *CgoBytePool) ResetCounters() {
+	atomic.StoreInt64(&p.gets, 0)
+	atomic.StoreInt64(&p.puts, 0)
+	atomic.StoreInt64(&p.fbMallocs, 0)
+	atomic.StoreInt64(&p.fbFrees, 0)
+	for _, pp := range p.pools {
+		pp.resetCounters()
+	}
+}
+
+// Trim frees all idle buffers held in freelists and returns the number of bytes released.
+func (p *CgoBytePool) Trim() int64 {
+	freed := int64(0)
+	for _, pp := range p.pools {
+		freed += pp.release(pp.Len())
+	}
+	return freed
+}
+
+// TrimTo frees idle buffers, largest size class first, until TotalAllocBytes
+// drops to bytes or no idle buffers remain. It returns the number of bytes released.
+func (p *CgoBytePool) TrimTo(bytes int64) int64 {
+	freed := int64(0)
+	for i := len(p.pools) - 1; 0 <= i; i -= 1 {
+		pp := p.pools[i]
+		for bytes < p.TotalAllocBytes() {
+			n := pp.release(1)
+			if n == 0 {
+				break
+			}
+			freed += n
+		}
+	}
+	return freed
+}
+
+// Close frees idle buffers and turns the pool into closed state.
+// Buffers still in use are not freed, they are freed when returned by Put,
+// and Get returns nil (TryGet returns ErrPoolClosed) afterwards.
+// Outstanding buffers can be checked with Stats or waited for with CloseWait.
 func (p *CgoBytePool) Close() {
+	if atomic.CompareAndSwapInt32(&p.closed, 0, 1) != true {
+		return
+	}
+
 	runtime.SetFinalizer(p, nil) // clear finalizer
+	if p.scavenger != nil {
+		p.scavenger.stop()
+	}
+	p.SaveWarmupProfile()
 	for _, pp := range p.pools {
 		pp.Close()
 	}
+	if p.name != "" {
+		defaultPoolRegistry.unregister(p.name, p)
+	}
+	if p.observer != nil {
+		p.observer.OnClose()
+	}
+	p.FlushTrace()
+	p.notifyDrained()
+}
+
+// CloseWait closes the pool and waits until all outstanding buffers are returned.
+// If ctx is done first, it returns an error that reports the outstanding buffers.
+func (p *CgoBytePool) CloseWait(ctx context.Context) error {
+	p.Close()
+
+	region := traceStartRegion(p.trace, traceRegionWait)
+	defer region.End()
+
+	traceLog(p.trace, "wait outstanding=%d", p.OutstandingCount())
+	select {
+	case <-p.drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %d buffers outstanding (%d fallbacks, %d bytes)",
+			ctx.Err(),
+			p.OutstandingCount(),
+			atomic.LoadInt64(&p.fbCount),
+			p.TotalAllocBytes(),
+		)
+	}
 }
 
 func finalizeDefaultPool(p *CgoBytePool) {
@@ -188,76 +665,330 @@ func finalizeDefaultPool(p *CgoBytePool) {
 }
 
 func NewPool(alignFunc MemoryAligmentFunc, poolFuncs ...WithPoolFunc) *CgoBytePool {
+	p, err := newPool(alignFunc, poolFuncs...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return p
+}
+
+// newPool creates pool, it returns ErrDuplicateName if the name of WithName is already registered.
+func newPool(alignFunc MemoryAligmentFunc, poolFuncs ...WithPoolFunc) (*CgoBytePool, error) {
 	if alignFunc == nil {
 		alignFunc = DefaultMemoryAlignmentFunc
 	}
 
-	pools := make([]*cmallocPool, len(poolFuncs))
-	for i, fn := range poolFuncs {
-		pools[i] = fn(alignFunc)
+	opt := &optPool{
+		allocator: defaultAllocator,
+		observers: make([]Observer, 0),
+	}
+	for _, fn := range poolFuncs {
+		fn(opt)
+	}
+
+	pools := make([]*cmallocPool, len(opt.sizes))
+	for i, s := range opt.sizes {
+		pools[i] = newCMallocPoolFreelist(newFreelist(s.freelist, s.poolSize), alignFunc(s.bufferSize), opt.allocator)
+		pools[i].trace = opt.runtimeTrace
 	}
 	sort.Slice(pools, func(i, j int) bool {
 		return pools[i].bufSize < pools[j].bufSize // order bufSize asc
 	})
+	observer := newObserver(opt.observers)
+	for i, pp := range pools {
+		pp.id = i
+		pp.observer = observer
+	}
 
-	p := &CgoBytePool{pools, 0, alignFunc, new(sync.Map)}
+	p := &CgoBytePool{
+		name:       opt.name,
+		pools:      pools,
+		bytes:      0,
+		budget:     opt.budget,
+		budgets:    newPoolBudgets(opt.budget),
+		alignFunc:  alignFunc,
+		allocator:  opt.allocator,
+		fallbacks:  new(sync.Map),
+		fbCount:    0,
+		fbMallocs:  0,
+		fbFrees:    0,
+		gets:       0,
+		puts:       0,
+		getting:    0,
+		trace:      opt.runtimeTrace,
+		observer:   observer,
+		recorder:   nil,
+		prefault:   opt.prefault,
+		warmupPath: opt.warmupPath,
+		closed:     0,
+		drainOnce:  new(sync.Once),
+		drained:    make(chan struct{}),
+	}
+	if opt.recorder != nil {
+		p.recorder = newRecorder(opt.recorder)
+	}
+	wp, err := p.loadWarmupProfile(opt.warmupPath, opt.warmupMaxAge)
+	if err != nil {
+		wp = warmupProfile{} // missing, invalid or stale profile warms by WithPrealloc only
+	}
+	p.warmFromProfile(wp, opt.prealloc)
+	if 0 < opt.profileRate {
+		p.profiler = newProfiler(opt.profileRate)
+	}
+	if 0 < opt.scavengeInterval {
+		// scavenger refers to pools only, so that finalizer of p can still run
+		p.scavenger = newScavenger(pools, opt.scavengeInterval, opt.scavengeIdleTTL)
+		p.scavenger.trace = opt.runtimeTrace
+		go p.scavenger.run()
+	}
+	if opt.name != "" {
+		// registered atomically, concurrent pools of the same name fail here
+		if err := defaultPoolRegistry.register(opt.name, p); err != nil {
+			p.warmupPath = "" // keep the profile of the registered pool
+			p.Close()
+			return nil, fmt.Errorf("%w: %s", err, opt.name)
+		}
+	}
 	runtime.SetFinalizer(p, finalizeDefaultPool)
-	return p
+	return p, nil
 }
 
 type cmallocPool struct {
-	pool    chan unsafe.Pointer
-	bufSize int
-	bytes   int64
+	pool        freelist
+	allocator   Allocator
+	bufSize     int
+	bytes       int64
+	outstanding int64
+	mallocs     int64
+	frees       int64
+	peak        int64 // highest outstanding
+	loadedPeak  int64 // peak of warmup profile
+	closed      int32
+	lowWater    int64 // fewest idle buffers seen since the last scavenge
+	scavenge    int64 // unixnano of the last scavenge
+	trace       bool
+	id          int
+	observer    Observer
 }
 
 func (p *cmallocPool) Get() unsafe.Pointer {
-	select {
-	case buf := <-p.pool:
+	p.updatePeak(atomic.AddInt64(&p.outstanding, 1))
+	if buf, ok := p.pool.pop(); ok {
 		// reuse
+		p.updateLowWater(int64(p.pool.len()))
 		return buf
-	default:
-		// new
-		atomic.AddInt64(&p.bytes, int64(p.bufSize))
-		return unsafe.Pointer(C.malloc(C.size_t(p.bufSize)))
 	}
+
+	// new
+	traceLog(p.trace, "freelist miss size=%d", p.bufSize)
+	region := traceStartRegion(p.trace, traceRegionMiss)
+	ptr := p.allocator.Alloc(p.bufSize)
+	region.End()
+	if ptr == nil {
+		atomic.AddInt64(&p.outstanding, -1)
+		return nil
+	}
+	if p.observer != nil {
+		p.observer.OnMalloc(p.id, p.bufSize, ptr)
+	}
+	atomic.AddInt64(&p.bytes, int64(p.bufSize))
+	atomic.AddInt64(&p.mallocs, 1)
+	return ptr
 }
 
 func (p *cmallocPool) Put(data unsafe.Pointer, size int) {
-	select {
-	case p.pool <- data:
-		// ok
-	default:
+	atomic.AddInt64(&p.outstanding, -1)
+	if p.isClosed() {
+		p.free(data)
+		return
+	}
+
+	if p.pool.push(data) {
+		if p.isClosed() {
+			// raced with Close, nobody will take it out anymore
+			p.release(p.Cap())
+		}
+	} else {
 		// release
-		C.free(data)
-		atomic.AddInt64(&p.bytes, -1*int64(p.bufSize))
+		traceLog(p.trace, "overflow free size=%d", p.bufSize)
+		if p.observer != nil {
+			p.observer.OnOverflow(p.id, p.bufSize, data)
+		}
+		p.free(data)
+	}
+}
+
+// warm allocates up to n buffers into the freelist and returns the number of buffers.
+func (p *cmallocPool) warm(n int, prefault bool) int {
+	warmed := 0
+	for ; warmed < n && p.pool.len() < p.pool.cap(); warmed += 1 {
+		ptr := p.allocator.Alloc(p.bufSize)
+		if ptr == nil {
+			return warmed
+		}
+		if prefault {
+			touchPages(ptr, p.bufSize)
+		}
+		atomic.AddInt64(&p.bytes, int64(p.bufSize))
+		atomic.AddInt64(&p.mallocs, 1)
+		if p.observer != nil {
+			p.observer.OnMalloc(p.id, p.bufSize, ptr)
+		}
+
+		if p.pool.push(ptr) != true {
+			p.free(ptr) // filled by concurrent Put
+			return warmed
+		}
+		if p.isClosed() {
+			// raced with Close
+			p.release(p.Cap())
+			return warmed + 1
+		}
+	}
+	return warmed
+}
+
+// touchPages writes to each page of ptr to fault it in.
+func touchPages(ptr unsafe.Pointer, size int) {
+	if size <= 0 {
+		return
+	}
+	data := unsafe.Slice((*byte)(ptr), size)
+	for i := 0; i < size; i += pageSize {
+		data[i] = 0
+	}
+	data[size-1] = 0
+}
+
+// discard frees buffer returned from outside instead of reusing it.
+func (p *cmallocPool) discard(data unsafe.Pointer) {
+	atomic.AddInt64(&p.outstanding, -1)
+	p.free(data)
+}
+
+func (p *cmallocPool) free(data unsafe.Pointer) {
+	if p.observer != nil {
+		p.observer.OnFree(p.id, p.bufSize, data)
+	}
+	p.allocator.Free(data, p.bufSize)
+	atomic.AddInt64(&p.bytes, -1*int64(p.bufSize))
+	atomic.AddInt64(&p.frees, 1)
+}
+
+func (p *cmallocPool) updatePeak(n int64) {
+	for {
+		curr := atomic.LoadInt64(&p.peak)
+		if n <= curr {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&p.peak, curr, n) {
+			return
+		}
+	}
+}
+
+func (p *cmallocPool) updateLowWater(n int64) {
+	for {
+		curr := atomic.LoadInt64(&p.lowWater)
+		if curr <= n {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&p.lowWater, curr, n) {
+			return
+		}
+	}
+}
+
+// release frees up to n idle buffers, coldest first, and returns the number of bytes released.
+func (p *cmallocPool) release(n int) int64 {
+	freed := int64(0)
+	for i := 0; i < n; i += 1 {
+		data, ok := p.pool.popCold()
+		if ok != true {
+			return freed
+		}
+		p.free(data)
+		freed += int64(p.bufSize)
+	}
+	return freed
+}
+
+// scavengeIdle frees the buffers that were never taken out of the freelist
+// since the last scavenge, once idleTTL has elapsed.
+func (p *cmallocPool) scavengeIdle(now time.Time, idleTTL time.Duration) int64 {
+	last := atomic.LoadInt64(&p.scavenge)
+	if now.UnixNano()-last < int64(idleTTL) {
+		return 0
 	}
+	freed := p.release(int(atomic.LoadInt64(&p.lowWater)))
+	atomic.StoreInt64(&p.lowWater, int64(p.pool.len()))
+	atomic.StoreInt64(&p.scavenge, now.UnixNano())
+	return freed
 }
 
 func (p *cmallocPool) AllocBytes() int64 {
 	return atomic.LoadInt64(&p.bytes)
 }
 
+func (p *cmallocPool) Outstanding() int64 {
+	return atomic.LoadInt64(&p.outstanding)
+}
+
+func (p *cmallocPool) Peak() int64 {
+	return atomic.LoadInt64(&p.peak)
+}
+
+func (p *cmallocPool) Mallocs() int64 {
+	return atomic.LoadInt64(&p.mallocs)
+}
+
+func (p *cmallocPool) Frees() int64 {
+	return atomic.LoadInt64(&p.frees)
+}
+
+func (p *cmallocPool) resetCounters() {
+	atomic.StoreInt64(&p.mallocs, 0)
+	atomic.StoreInt64(&p.frees, 0)
+}
+
+func (p *cmallocPool) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
+
 func (p *cmallocPool) Len() int {
-	return len(p.pool)
+	return p.pool.len()
 }
 
 func (p *cmallocPool) Cap() int {
-	return cap(p.pool)
+	return p.pool.cap()
 }
 
+// Close frees idle buffers, the freelist stays usable so that late Put does not panic.
 func (p *cmallocPool) Close() {
-	close(p.pool)
-	for data := range p.pool {
-		C.free(data)
-		atomic.AddInt64(&p.bytes, -1*int64(p.bufSize))
-	}
+	atomic.StoreInt32(&p.closed, 1)
+	p.release(p.Cap())
+}
+
+func newCMallocPool(poolSize, bufSize int, allocator Allocator) *cmallocPool {
+	return newCMallocPoolFreelist(newChanFreelist(poolSize), bufSize, allocator)
 }
 
-func newCMallocPool(poolSize, bufSize int) *cmallocPool {
+func newCMallocPoolFreelist(pool freelist, bufSize int, allocator Allocator) *cmallocPool {
 	return &cmallocPool{
-		pool:    make(chan unsafe.Pointer, poolSize),
-		bufSize: bufSize,
-		bytes:   0,
+		pool:        pool,
+		allocator:   allocator,
+		bufSize:     bufSize,
+		bytes:       0,
+		outstanding: 0,
+		mallocs:     0,
+		frees:       0,
+		peak:        0,
+		loadedPeak:  0,
+		closed:      0,
+		lowWater:    0,
+		scavenge:    time.Now().UnixNano(),
+		trace:       false,
+		id:          0,
+		observer:    nil,
 	}
 }
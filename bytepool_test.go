@@ -1,14 +1,17 @@
 package cgobytepool
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 	"unsafe"
 )
 
 func TestCMallocPool(t *testing.T) {
 	t.Run("AllocBytes", func(tt *testing.T) {
 		poolSize := 10
-		p := newCMallocPool(poolSize, 100)
+		p := newCMallocPool(poolSize, 100, defaultAllocator)
 		defer p.Close()
 
 		ptr1 := p.Get()
@@ -48,7 +51,7 @@ func TestCMallocPool(t *testing.T) {
 		}
 	})
 	t.Run("Get/Put", func(tt *testing.T) {
-		p := newCMallocPool(1, 100)
+		p := newCMallocPool(1, 100, defaultAllocator)
 		defer p.Close()
 
 		ptr1 := p.Get()
@@ -176,4 +179,285 @@ func TestCgoBytePool(t *testing.T) {
 			tt.Errorf("in pool alloc actual=%d", p.pools[2].AllocBytes())
 		}
 	})
+	t.Run("Trim", func(tt *testing.T) {
+		p := NewPool(
+			DefaultMemoryAlignmentFunc,
+			WithPoolSize(2, 100),
+			WithPoolSize(2, 200),
+		)
+		defer p.Close()
+
+		ptr1, ptr2 := p.Get(100), p.Get(200)
+		ptr3 := p.Get(200)
+		p.Put(ptr1, 100)
+		p.Put(ptr2, 200)
+		if p.TotalAllocBytes() != 1264 {
+			tt.Errorf("3 buffers alloc actual=%d", p.TotalAllocBytes())
+		}
+
+		if freed := p.Trim(); freed != 808 {
+			tt.Errorf("2 idle buffers freed actual=%d", freed)
+		}
+		if p.TotalAllocBytes() != 456 {
+			tt.Errorf("ptr3 is active actual=%d", p.TotalAllocBytes())
+		}
+		p.Put(ptr3, 200)
+	})
+	t.Run("TrimTo", func(tt *testing.T) {
+		p := NewPool(
+			DefaultMemoryAlignmentFunc,
+			WithPoolSize(2, 100),
+			WithPoolSize(2, 200),
+		)
+		defer p.Close()
+
+		ptr1, ptr2 := p.Get(100), p.Get(100)
+		ptr3, ptr4 := p.Get(200), p.Get(200)
+		p.Put(ptr1, 100)
+		p.Put(ptr2, 100)
+		p.Put(ptr3, 200)
+		p.Put(ptr4, 200)
+		if p.TotalAllocBytes() != 1616 {
+			tt.Errorf("4 buffers alloc actual=%d", p.TotalAllocBytes())
+		}
+
+		// large class first
+		if freed := p.TrimTo(1000); freed != 912 {
+			tt.Errorf("2 large buffers freed actual=%d", freed)
+		}
+		if p.pools[0].Len() != 2 {
+			tt.Errorf("small buffers remain actual=%d", p.pools[0].Len())
+		}
+		if freed := p.TrimTo(0); freed != 704 {
+			tt.Errorf("all buffers freed actual=%d", freed)
+		}
+		if p.TotalAllocBytes() != 0 {
+			tt.Errorf("all buffers freed actual=%d", p.TotalAllocBytes())
+		}
+	})
+	t.Run("Close", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(2, 100))
+
+		ptr1 := p.Get(100)
+		ptr2 := p.Get(500) // fallback
+		ptr3 := p.Get(100)
+		p.Put(ptr3, 100)
+
+		p.Close()
+		p.Close() // no panic
+		if p.TotalAllocBytes() != 1104 {
+			tt.Errorf("idle buffer freed, in-use buffers remain actual=%d", p.TotalAllocBytes())
+		}
+		stats := p.Stats()
+		if stats.Closed != true {
+			tt.Errorf("closed")
+		}
+		if stats.Outstanding.Count != 2 {
+			tt.Errorf("ptr1 and ptr2 outstanding actual=%d", stats.Outstanding.Count)
+		}
+		if stats.Outstanding.Fallbacks != 1 {
+			tt.Errorf("ptr2 is fallback actual=%d", stats.Outstanding.Fallbacks)
+		}
+
+		if ptr := p.Get(100); ptr != nil {
+			tt.Errorf("closed pool returns nil")
+		}
+		if _, err := p.TryGet(100); errors.Is(err, ErrPoolClosed) != true {
+			tt.Errorf("closed pool returns error: %+v", err)
+		}
+
+		p.Put(ptr1, 100) // no panic
+		p.Put(ptr2, 500)
+		if p.TotalAllocBytes() != 0 {
+			tt.Errorf("late put frees buffer actual=%d", p.TotalAllocBytes())
+		}
+		if p.OutstandingCount() != 0 {
+			tt.Errorf("all returned actual=%d", p.OutstandingCount())
+		}
+	})
+	t.Run("CloseWait", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(2, 100))
+
+		ptr1 := p.Get(100)
+		ptr2 := p.Get(500)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			p.Put(ptr1, 100)
+			p.Put(ptr2, 500)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := p.CloseWait(ctx); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+		if p.TotalAllocBytes() != 0 {
+			tt.Errorf("all freed actual=%d", p.TotalAllocBytes())
+		}
+	})
+	t.Run("CloseWait/timeout", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(2, 100))
+
+		ptr := p.Get(500)
+		defer p.Put(ptr, 500)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := p.CloseWait(ctx)
+		if errors.Is(err, context.DeadlineExceeded) != true {
+			tt.Errorf("deadline exceeded: %+v", err)
+		}
+		tt.Logf("%+v", err)
+	})
+	t.Run("CloseWait/get_in_progress", func(tt *testing.T) {
+		a := &blockingAllocator{
+			Allocator: NewMallocAllocator(),
+			entered:   make(chan struct{}),
+			release:   make(chan struct{}),
+		}
+		p := NewPool(DefaultMemoryAlignmentFunc, WithAllocator(a))
+
+		got := make(chan unsafe.Pointer)
+		go func() {
+			got <- p.Get(500) // fallback blocks in Alloc
+		}()
+		<-a.entered
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := p.CloseWait(ctx); errors.Is(err, context.DeadlineExceeded) != true {
+			tt.Errorf("Get in progress must not be drained: %+v", err)
+		}
+
+		close(a.release)
+		ptr := <-got
+		if ptr == nil {
+			tt.Fatalf("Get passed closed check before Close")
+		}
+		if p.OutstandingCount() != 1 {
+			tt.Errorf("outstanding actual=%d", p.OutstandingCount())
+		}
+		select {
+		case <-p.drained:
+			tt.Fatalf("drained with outstanding buffer")
+		default:
+		}
+		p.Put(ptr, 500)
+
+		ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel2()
+
+		if err := p.CloseWait(ctx2); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+	})
+	t.Run("Counters", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 100))
+		defer p.Close()
+
+		ptr1 := p.Get(100)
+		p.Put(ptr1, 100)
+		ptr2 := p.Get(100) // reuse
+		ptr3 := p.Get(100) // malloc
+		ptr4 := p.Get(500) // fallback
+		p.Put(ptr2, 100)
+		p.Put(ptr3, 100) // overflow free
+		p.Put(ptr4, 500)
+
+		c := p.Stats().Counters
+		if c.Gets != 4 || c.Puts != 4 {
+			tt.Errorf("gets=%d puts=%d", c.Gets, c.Puts)
+		}
+		if c.Mallocs != 3 {
+			tt.Errorf("ptr1 + ptr3 + ptr4 actual=%d", c.Mallocs)
+		}
+		if c.Frees != 2 {
+			tt.Errorf("ptr3 + ptr4 actual=%d", c.Frees)
+		}
+	})
+}
+
+func TestWarm(t *testing.T) {
+	t.Run("prealloc", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc,
+			WithPoolSize(10, 4096),
+			WithPoolSize(10, 512),
+			WithPrealloc(5, 512),
+			WithPrealloc(100, 4096), // capped by pool size
+		)
+		defer p.Close()
+
+		if p.pools[0].Len() != 5 {
+			tt.Errorf("512 class expect 5 idle actual=%d", p.pools[0].Len())
+		}
+		if p.pools[1].Len() != 10 {
+			tt.Errorf("4096 class capped to 10 actual=%d", p.pools[1].Len())
+		}
+
+		mallocs := p.Stats().Counters.Mallocs
+		ptr := p.Get(512)
+		p.Put(ptr, 512)
+		if m := p.Stats().Counters.Mallocs; m != mallocs {
+			tt.Errorf("first Get must not malloc actual=%d", m-mallocs)
+		}
+		if p.OutstandingCount() != 0 {
+			tt.Errorf("warmed buffers are idle actual=%d", p.OutstandingCount())
+		}
+	})
+	t.Run("warm", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(4, 512))
+		defer p.Close()
+
+		if n := p.Warm(3, 100); n != 3 {
+			tt.Errorf("expect 3 actual=%d", n)
+		}
+		if n := p.Warm(3, 100); n != 1 {
+			tt.Errorf("expect remaining capacity 1 actual=%d", n)
+		}
+		if n := p.Warm(3, 100000); n != 0 {
+			tt.Errorf("fallback size expect 0 actual=%d", n)
+		}
+		if b := p.TotalAllocBytes(); b != int64(4*p.pools[0].bufSize) {
+			tt.Errorf("allocated bytes actual=%d", b)
+		}
+	})
+	t.Run("prefault", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(2, 64*1024), WithPrefault(), WithPrealloc(2, 64*1024))
+		defer p.Close()
+
+		if p.pools[0].Len() != 2 {
+			tt.Errorf("expect 2 idle actual=%d", p.pools[0].Len())
+		}
+	})
+	t.Run("closed", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(4, 512))
+		p.Close()
+
+		if n := p.Warm(3, 100); n != 0 {
+			tt.Errorf("closed pool expect 0 actual=%d", n)
+		}
+	})
+	t.Run("alloc_fail", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(4, 512), WithAllocator(NewFaultAllocator(nil, WithFailNth(3))))
+		defer p.Close()
+
+		if n := p.Warm(4, 100); n != 2 {
+			tt.Errorf("stop at failure expect 2 actual=%d", n)
+		}
+	})
+}
+
+type blockingAllocator struct {
+	Allocator
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (a *blockingAllocator) Alloc(size int) unsafe.Pointer {
+	close(a.entered)
+	<-a.release
+	return a.Allocator.Alloc(size)
 }
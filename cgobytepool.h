@@ -0,0 +1,23 @@
+#ifndef CGOBYTEPOOL_H
+#define CGOBYTEPOOL_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+// cgobytepool_putq_t is bounded MPSC queue allocated in C memory.
+// C threads enqueue returned buffers without calling into Go,
+// Go drains them back into the pool (see PutQueue).
+typedef struct cgobytepool_putq_t cgobytepool_putq_t;
+
+cgobytepool_putq_t *cgobytepool_putq_new(size_t capacity);
+void cgobytepool_putq_free(cgobytepool_putq_t *q);
+
+// returns 0 on success, -1 if queue is full (then put buffer synchronously).
+int cgobytepool_putq_enqueue(cgobytepool_putq_t *q, void *data, size_t size);
+
+size_t cgobytepool_putq_drain(cgobytepool_putq_t *q, void **datas, size_t *sizes, size_t max, uint64_t *wait_ns_max, uint64_t *wait_ns_sum);
+size_t cgobytepool_putq_len(cgobytepool_putq_t *q);
+size_t cgobytepool_putq_cap(cgobytepool_putq_t *q);
+uint64_t cgobytepool_putq_rejected(cgobytepool_putq_t *q);
+
+#endif
@@ -0,0 +1,44 @@
+// Package cgobytepooltest provides test helpers for code using cgobytepool.
+package cgobytepooltest
+
+import (
+	"testing"
+
+	"github.com/octu0/cgobytepool"
+)
+
+// VerifyNoLeaks fails the test if any buffers of p are outstanding when the test finishes.
+// p must report PoolStats.Outstanding, as CgoBytePool does.
+func VerifyNoLeaks(t testing.TB, p cgobytepool.Pool) {
+	t.Helper()
+
+	t.Cleanup(func() {
+		stats := p.Stats()
+		if 0 < stats.Outstanding.Count {
+			t.Errorf("cgobytepool: %d buffers leaked (%d fallbacks)", stats.Outstanding.Count, stats.Outstanding.Fallbacks)
+		}
+	})
+}
+
+type CAllocs struct {
+	Gets    float64 // average number of Get per run
+	Mallocs float64 // average number of Allocator.Alloc per run
+}
+
+// CAllocsPerRun is like testing.AllocsPerRun but for C memory of pool:
+// it returns the average number of Get and malloc made by f, after a warm-up run.
+// p must report PoolStats.Counters, as CgoBytePool does.
+func CAllocsPerRun(p cgobytepool.Pool, runs int, f func()) CAllocs {
+	f() // warm up
+
+	before := p.Stats().Counters
+	for i := 0; i < runs; i += 1 {
+		f()
+	}
+	after := p.Stats().Counters
+
+	return CAllocs{
+		Gets:    float64(after.Gets-before.Gets) / float64(runs),
+		Mallocs: float64(after.Mallocs-before.Mallocs) / float64(runs),
+	}
+}
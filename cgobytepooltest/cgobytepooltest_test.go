@@ -0,0 +1,174 @@
+package cgobytepooltest
+
+import (
+	"testing"
+
+	"github.com/octu0/cgobytepool"
+)
+
+type fakeTB struct {
+	testing.TB
+	cleanups []func()
+	errors   int
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors += 1
+}
+
+func (f *fakeTB) finish() {
+	for i := len(f.cleanups) - 1; 0 <= i; i -= 1 {
+		f.cleanups[i]()
+	}
+}
+
+func TestVerifyNoLeaks(t *testing.T) {
+	t.Run("noleak", func(tt *testing.T) {
+		p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc, cgobytepool.WithPoolSize(10, 64))
+		defer p.Close()
+
+		f := &fakeTB{TB: tt}
+		VerifyNoLeaks(f, p)
+		ptr := p.Get(64)
+		p.Put(ptr, 64)
+		f.finish()
+
+		if f.errors != 0 {
+			tt.Errorf("no leak expect error=0 actual=%d", f.errors)
+		}
+	})
+	t.Run("leak", func(tt *testing.T) {
+		p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc, cgobytepool.WithPoolSize(10, 64))
+		defer p.Close()
+
+		f := &fakeTB{TB: tt}
+		VerifyNoLeaks(f, p)
+		ptr := p.Get(64)
+		f.finish()
+		p.Put(ptr, 64)
+
+		if f.errors != 1 {
+			tt.Errorf("leak expect error=1 actual=%d", f.errors)
+		}
+	})
+	t.Run("cleanup", func(tt *testing.T) {
+		p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc)
+		defer p.Close()
+
+		VerifyNoLeaks(tt, p)
+		ptr := p.Get(100)
+		p.Put(ptr, 100)
+	})
+}
+
+func TestCAllocsPerRun(t *testing.T) {
+	t.Run("reuse", func(tt *testing.T) {
+		p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc, cgobytepool.WithPoolSize(10, 64))
+		defer p.Close()
+
+		a := CAllocsPerRun(p, 100, func() {
+			ptr1 := p.Get(64)
+			ptr2 := p.Get(64)
+			p.Put(ptr1, 64)
+			p.Put(ptr2, 64)
+		})
+		if a.Gets != 2 {
+			tt.Errorf("expect 2 gets actual=%f", a.Gets)
+		}
+		if a.Mallocs != 0 {
+			tt.Errorf("warmed up pool expect 0 mallocs actual=%f", a.Mallocs)
+		}
+	})
+	t.Run("fallback", func(tt *testing.T) {
+		p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc, cgobytepool.WithPoolSize(10, 64))
+		defer p.Close()
+
+		a := CAllocsPerRun(p, 100, func() {
+			ptr := p.Get(1024)
+			p.Put(ptr, 1024)
+		})
+		if a.Gets != 1 {
+			tt.Errorf("expect 1 get actual=%f", a.Gets)
+		}
+		if a.Mallocs != 1 {
+			tt.Errorf("fallback expect 1 malloc actual=%f", a.Mallocs)
+		}
+	})
+}
+
+func TestRecordingPool(t *testing.T) {
+	t.Run("calls", func(tt *testing.T) {
+		r := NewRecordingPool(nil)
+		ptr1 := r.Get(100)
+		ptr2 := r.Get(200)
+		r.Put(ptr2, 200)
+		r.Put(ptr1, 100)
+		r.Close()
+
+		r.AssertCalls(tt, Get(100), Get(200), Put(200), Put(100), Close())
+
+		calls := r.Calls()
+		if calls[0].Ptr != ptr1 || calls[3].Ptr != ptr1 {
+			tt.Errorf("recorded pointer mismatch")
+		}
+	})
+	t.Run("mismatch", func(tt *testing.T) {
+		r := NewRecordingPool(nil)
+		defer r.Close()
+
+		ptr := r.Get(100)
+		r.Put(ptr, 100)
+
+		f := &fakeTB{TB: tt}
+		r.AssertCalls(f, Get(100))
+		if f.errors != 1 {
+			tt.Errorf("length mismatch expect error=1 actual=%d", f.errors)
+		}
+
+		f = &fakeTB{TB: tt}
+		r.AssertCalls(f, Get(100), Put(200))
+		if f.errors != 1 {
+			tt.Errorf("size mismatch expect error=1 actual=%d", f.errors)
+		}
+	})
+	t.Run("foreign_put", func(tt *testing.T) {
+		p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc)
+		defer p.Close()
+
+		r := NewRecordingPool(p)
+		ptr := p.Get(100) // not through r
+		r.Put(ptr, 100)
+
+		f := &fakeTB{TB: tt}
+		r.AssertCalls(f, Put(100))
+		if f.errors != 1 {
+			tt.Errorf("put without get expect error=1 actual=%d", f.errors)
+		}
+	})
+	t.Run("reset", func(tt *testing.T) {
+		r := NewRecordingPool(nil)
+		defer r.Close()
+
+		ptr := r.Get(100)
+		r.Put(ptr, 100)
+		r.Reset()
+		r.AssertCalls(tt)
+	})
+	t.Run("handle", func(tt *testing.T) {
+		r := NewRecordingPool(nil)
+		defer r.Close()
+
+		h := cgobytepool.CgoHandle(r)
+		defer h.Release()
+
+		ptr := cgobytepool.HandlePoolGetByValue(uintptr(h), 64)
+		cgobytepool.HandlePoolPutByValue(uintptr(h), ptr, 64)
+		r.AssertCalls(tt, Get(64), Put(64))
+	})
+}
@@ -0,0 +1,150 @@
+package cgobytepooltest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/octu0/cgobytepool"
+)
+
+var (
+	_ cgobytepool.Pool = (*RecordingPool)(nil)
+)
+
+type Op string
+
+const (
+	OpGet   Op = "Get"
+	OpPut   Op = "Put"
+	OpClose Op = "Close"
+)
+
+type Call struct {
+	Op   Op
+	Size int
+	Ptr  unsafe.Pointer
+}
+
+func (c Call) String() string {
+	if c.Op == OpClose {
+		return string(c.Op)
+	}
+	return fmt.Sprintf("%s(%d)", c.Op, c.Size)
+}
+
+func Get(size int) Call {
+	return Call{Op: OpGet, Size: size}
+}
+
+func Put(size int) Call {
+	return Call{Op: OpPut, Size: size}
+}
+
+func Close() Call {
+	return Call{Op: OpClose}
+}
+
+// RecordingPool is a Pool that records every call, including calls from C through CgoHandle.
+type RecordingPool struct {
+	pool  cgobytepool.Pool
+	mutex *sync.Mutex
+	calls []Call
+}
+
+func (r *RecordingPool) record(c Call) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.calls = append(r.calls, c)
+}
+
+func (r *RecordingPool) Get(size int) unsafe.Pointer {
+	ptr := r.pool.Get(size)
+	r.record(Call{Op: OpGet, Size: size, Ptr: ptr})
+	return ptr
+}
+
+func (r *RecordingPool) Put(ptr unsafe.Pointer, size int) {
+	r.record(Call{Op: OpPut, Size: size, Ptr: ptr})
+	r.pool.Put(ptr, size)
+}
+
+func (r *RecordingPool) Close() {
+	r.record(Call{Op: OpClose})
+	r.pool.Close()
+}
+
+func (r *RecordingPool) Stats() cgobytepool.PoolStats {
+	return r.pool.Stats()
+}
+
+// Calls returns copy of recorded calls.
+func (r *RecordingPool) Calls() []Call {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	calls := make([]Call, len(r.calls))
+	copy(calls, r.calls)
+	return calls
+}
+
+func (r *RecordingPool) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.calls = r.calls[:0]
+}
+
+// AssertCalls fails the test unless the recorded calls match want in order (Op and Size),
+// and every Put returns a pointer obtained from an earlier Get.
+func (r *RecordingPool) AssertCalls(t testing.TB, want ...Call) {
+	t.Helper()
+
+	calls := r.Calls()
+	if len(calls) != len(want) {
+		t.Errorf("cgobytepool: %d calls, want %d\n got: %s\nwant: %s", len(calls), len(want), joinCalls(calls), joinCalls(want))
+		return
+	}
+	for i := range calls {
+		if calls[i].Op != want[i].Op || calls[i].Size != want[i].Size {
+			t.Errorf("cgobytepool: calls[%d] = %s, want %s\n got: %s\nwant: %s", i, calls[i], want[i], joinCalls(calls), joinCalls(want))
+			return
+		}
+	}
+
+	gets := make(map[unsafe.Pointer]bool)
+	for i, c := range calls {
+		switch c.Op {
+		case OpGet:
+			gets[c.Ptr] = true
+		case OpPut:
+			if gets[c.Ptr] != true {
+				t.Errorf("cgobytepool: calls[%d] = %s puts %p which is not returned by Get", i, c, c.Ptr)
+			}
+			delete(gets, c.Ptr)
+		}
+	}
+}
+
+func joinCalls(calls []Call) string {
+	s := make([]string, len(calls))
+	for i, c := range calls {
+		s[i] = c.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// NewRecordingPool records calls to p, if p is nil a CgoBytePool without size classes is used.
+func NewRecordingPool(p cgobytepool.Pool) *RecordingPool {
+	if p == nil {
+		p = cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc)
+	}
+	return &RecordingPool{
+		pool:  p,
+		mutex: new(sync.Mutex),
+		calls: make([]Call, 0, 64),
+	}
+}
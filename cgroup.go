@@ -0,0 +1,264 @@
+package cgobytepool
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCgroupPath              string        = "/sys/fs/cgroup"
+	defaultCgroupInterval          time.Duration = 1 * time.Second
+	defaultCgroupUsageThreshold    float64       = 0.8
+	defaultCgroupPressureThreshold float64       = 10.0
+)
+
+var (
+	ErrInvalidCgroupThreshold = errors.New("cgobytepool: cgroup threshold must be 0 <= usage < 1 and 0 <= pressure < 100")
+)
+
+type CgroupStat struct {
+	Current           int64 // memory.current
+	Max               int64 // memory.max, 0 means "max" (unlimited)
+	SomePressureAvg10 float64
+	FullPressureAvg10 float64
+}
+
+func (s CgroupStat) Usage() float64 {
+	if s.Max <= 0 {
+		return 0
+	}
+	return float64(s.Current) / float64(s.Max)
+}
+
+type CgroupWatcherOptionFunc func(*optCgroupWatcher)
+
+type optCgroupWatcher struct {
+	path              string
+	interval          time.Duration
+	usageThreshold    float64
+	pressureThreshold float64
+}
+
+func WithCgroupPath(path string) CgroupWatcherOptionFunc {
+	return func(opt *optCgroupWatcher) {
+		opt.path = path
+	}
+}
+
+func WithCgroupInterval(interval time.Duration) CgroupWatcherOptionFunc {
+	return func(opt *optCgroupWatcher) {
+		opt.interval = interval
+	}
+}
+
+// WithCgroupThreshold sets the memory.current/memory.max ratio and the
+// "some avg10" pressure percentage above which the pool starts trimming.
+// NewCgroupWatcher returns ErrInvalidCgroupThreshold unless 0 <= usage < 1 and 0 <= pressure < 100.
+func WithCgroupThreshold(usage, pressure float64) CgroupWatcherOptionFunc {
+	return func(opt *optCgroupWatcher) {
+		opt.usageThreshold = usage
+		opt.pressureThreshold = pressure
+	}
+}
+
+// CgroupWatcher trims the freelists of CgoBytePool and tightens its memory budget
+// while the cgroup v2 memory usage or pressure is above threshold, and removes
+// its limit once the pressure goes away. It can run with MemoryGovernor on the same pool,
+// the tightest budget of both is used.
+type CgroupWatcher struct {
+	pool *CgoBytePool
+	opt  *optCgroupWatcher
+	once *sync.Once
+	done chan struct{}
+}
+
+// Check reads the cgroup files once and applies the budget for current pressure.
+func (w *CgroupWatcher) Check() (CgroupStat, error) {
+	stat, err := ReadCgroupStat(w.opt.path)
+	if err != nil {
+		return CgroupStat{}, err
+	}
+	w.apply(stat)
+	return stat, nil
+}
+
+func (w *CgroupWatcher) severity(stat CgroupStat) float64 {
+	if 0 < stat.FullPressureAvg10 {
+		return 1.0 // all tasks stalled on memory
+	}
+
+	s := 0.0
+	if usage := stat.Usage(); w.opt.usageThreshold <= usage {
+		s = (usage - w.opt.usageThreshold) / (1.0 - w.opt.usageThreshold)
+	}
+	if w.opt.pressureThreshold <= stat.SomePressureAvg10 {
+		ps := (stat.SomePressureAvg10 - w.opt.pressureThreshold) / (100.0 - w.opt.pressureThreshold)
+		if s < ps {
+			s = ps
+		}
+	}
+	if s <= 0 {
+		return 0
+	}
+	if 1.0 < s {
+		return 1.0
+	}
+	return s
+}
+
+func (w *CgroupWatcher) apply(stat CgroupStat) {
+	s := w.severity(stat)
+	if s <= 0 {
+		w.pool.clearBudgetLimit(w) // relax
+		return
+	}
+
+	// keep in-use buffers, release idle buffers in proportion to severity
+	total := w.pool.TotalAllocBytes()
+	budget := total - int64(math.Round(float64(w.pool.idleBytes())*s))
+	if budget < 1 {
+		budget = 1 // 0 means unlimited
+	}
+	w.pool.setBudgetLimit(w, budget)
+}
+
+func (w *CgroupWatcher) run() {
+	ticker := time.NewTicker(w.opt.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.Check() // ignore read error, cgroup may be temporarily unavailable
+		}
+	}
+}
+
+func (w *CgroupWatcher) Start() {
+	go w.run()
+}
+
+// Stop stops watching and removes the limit of the watcher from the pool budget.
+func (w *CgroupWatcher) Stop() {
+	w.once.Do(func() {
+		close(w.done)
+		w.pool.clearBudgetLimit(w)
+	})
+}
+
+// NewCgroupWatcher creates watcher of the cgroup v2 memory controller, it returns
+// ErrInvalidCgroupThreshold for thresholds out of range.
+func NewCgroupWatcher(p *CgoBytePool, funcs ...CgroupWatcherOptionFunc) (*CgroupWatcher, error) {
+	opt := &optCgroupWatcher{
+		path:              defaultCgroupPath,
+		interval:          defaultCgroupInterval,
+		usageThreshold:    defaultCgroupUsageThreshold,
+		pressureThreshold: defaultCgroupPressureThreshold,
+	}
+	for _, fn := range funcs {
+		fn(opt)
+	}
+	// severity divides by (1 - usage) and (100 - pressure), NaN is also rejected
+	if (0 <= opt.usageThreshold && opt.usageThreshold < 1) != true {
+		return nil, fmt.Errorf("%w: usage=%v", ErrInvalidCgroupThreshold, opt.usageThreshold)
+	}
+	if (0 <= opt.pressureThreshold && opt.pressureThreshold < 100) != true {
+		return nil, fmt.Errorf("%w: pressure=%v", ErrInvalidCgroupThreshold, opt.pressureThreshold)
+	}
+	return &CgroupWatcher{
+		pool: p,
+		opt:  opt,
+		once: new(sync.Once),
+		done: make(chan struct{}),
+	}, nil
+}
+
+func ReadCgroupStat(path string) (CgroupStat, error) {
+	current, err := readCgroupInt(filepath.Join(path, "memory.current"))
+	if err != nil {
+		return CgroupStat{}, err
+	}
+	limit, err := readCgroupInt(filepath.Join(path, "memory.max"))
+	if err != nil {
+		return CgroupStat{}, err
+	}
+	some, full, err := readCgroupPressure(filepath.Join(path, "memory.pressure"))
+	if err != nil {
+		return CgroupStat{}, err
+	}
+	return CgroupStat{
+		Current:           current,
+		Max:               limit,
+		SomePressureAvg10: some,
+		FullPressureAvg10: full,
+	}, nil
+}
+
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	s := string(bytes.TrimSpace(data))
+	if s == "max" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return n, nil
+}
+
+// readCgroupPressure parses PSI format:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readCgroupPressure(path string) (float64, float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	some, full := 0.0, 0.0
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		avg10 := 0.0
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "avg10=") != true {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimPrefix(field, "avg10="), 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("%s: %w", path, err)
+			}
+			avg10 = v
+		}
+		switch fields[0] {
+		case "some":
+			some = avg10
+		case "full":
+			full = avg10
+		}
+	}
+	if err := s.Err(); err != nil {
+		return 0, 0, err
+	}
+	return some, full, nil
+}
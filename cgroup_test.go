@@ -0,0 +1,158 @@
+package cgobytepool
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"unsafe"
+)
+
+func TestReadCgroupStat(t *testing.T) {
+	t.Run("normal", func(tt *testing.T) {
+		stat, err := ReadCgroupStat("testdata/cgroup/normal")
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if stat.Current != 104857600 {
+			tt.Errorf("actual=%d", stat.Current)
+		}
+		if stat.Max != 1073741824 {
+			tt.Errorf("actual=%d", stat.Max)
+		}
+		if stat.SomePressureAvg10 != 0 || stat.FullPressureAvg10 != 0 {
+			tt.Errorf("actual=%+v", stat)
+		}
+	})
+	t.Run("stall", func(tt *testing.T) {
+		stat, err := ReadCgroupStat("testdata/cgroup/stall")
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if stat.SomePressureAvg10 != 45.10 {
+			tt.Errorf("actual=%f", stat.SomePressureAvg10)
+		}
+		if stat.FullPressureAvg10 != 12.30 {
+			tt.Errorf("actual=%f", stat.FullPressureAvg10)
+		}
+	})
+	t.Run("unlimited", func(tt *testing.T) {
+		stat, err := ReadCgroupStat("testdata/cgroup/unlimited")
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if stat.Max != 0 {
+			tt.Errorf("max means unlimited actual=%d", stat.Max)
+		}
+		if stat.Usage() != 0 {
+			tt.Errorf("actual=%f", stat.Usage())
+		}
+	})
+	t.Run("notfound", func(tt *testing.T) {
+		if _, err := ReadCgroupStat("testdata/cgroup/notfound"); err == nil {
+			tt.Errorf("must error")
+		}
+	})
+}
+
+func TestCgroupWatcher(t *testing.T) {
+	newPool := func() (*CgoBytePool, unsafe.Pointer) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100))
+		ptrs := make([]unsafe.Pointer, 5)
+		for i := 0; i < 5; i += 1 {
+			ptrs[i] = p.Get(100)
+		}
+		for i := 1; i < 5; i += 1 {
+			p.Put(ptrs[i], 100)
+		}
+		return p, ptrs[0] // 1 in use + 4 idle
+	}
+	t.Run("high_usage", func(tt *testing.T) {
+		p, ptr := newPool()
+		defer p.Close()
+
+		w, err := NewCgroupWatcher(p, WithCgroupPath("testdata/cgroup/high_usage"))
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		defer w.Stop()
+
+		if _, err := w.Check(); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		// usage 0.9 = severity 0.5: release half of idle buffers
+		if p.MemoryBudget() != 1056 {
+			tt.Errorf("budget actual=%d", p.MemoryBudget())
+		}
+		if p.TotalAllocBytes() != 1056 {
+			tt.Errorf("2 idle buffers released actual=%d", p.TotalAllocBytes())
+		}
+
+		w.opt.path = "testdata/cgroup/normal"
+		if _, err := w.Check(); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if p.MemoryBudget() != 0 {
+			tt.Errorf("budget restored actual=%d", p.MemoryBudget())
+		}
+		p.Put(ptr, 100)
+	})
+	t.Run("stall", func(tt *testing.T) {
+		p, ptr := newPool()
+		defer p.Close()
+
+		w, err := NewCgroupWatcher(p, WithCgroupPath("testdata/cgroup/stall"))
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		defer w.Stop()
+
+		if _, err := w.Check(); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if p.TotalAllocBytes() != 352 {
+			tt.Errorf("all idle buffers released actual=%d", p.TotalAllocBytes())
+		}
+
+		if p.MemoryBudget() != 352 {
+			tt.Errorf("budget keeps in-use buffers actual=%d", p.MemoryBudget())
+		}
+
+		// over budget: returned buffer is freed
+		ptr2 := p.Get(100)
+		p.Put(ptr2, 100)
+		p.Put(ptr, 100)
+		if p.TotalAllocBytes() != 352 {
+			tt.Errorf("over budget buffer freed actual=%d", p.TotalAllocBytes())
+		}
+	})
+	t.Run("base budget", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100), WithMemoryBudget(10000))
+		defer p.Close()
+
+		w, err := NewCgroupWatcher(p, WithCgroupPath("testdata/cgroup/stall"))
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		w.Check()
+		if p.MemoryBudget() != 1 {
+			tt.Errorf("tightest budget actual=%d", p.MemoryBudget())
+		}
+		w.Stop()
+		if p.MemoryBudget() != 10000 {
+			tt.Errorf("budget restored actual=%d", p.MemoryBudget())
+		}
+	})
+	t.Run("invalid threshold", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100))
+		defer p.Close()
+
+		for _, th := range [][2]float64{{1.0, 10}, {1.5, 10}, {-0.1, 10}, {0.8, 100}, {0.8, -1}, {math.NaN(), 10}} {
+			if _, err := NewCgroupWatcher(p, WithCgroupThreshold(th[0], th[1])); errors.Is(err, ErrInvalidCgroupThreshold) != true {
+				tt.Errorf("usage=%v pressure=%v expect ErrInvalidCgroupThreshold actual=%+v", th[0], th[1], err)
+			}
+		}
+		if _, err := NewCgroupWatcher(p, WithCgroupThreshold(0, 0)); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+	})
+}
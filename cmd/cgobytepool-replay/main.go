@@ -0,0 +1,146 @@
+// Command cgobytepool-replay replays a trace recorded by cgobytepool.WithRecorder
+// against alternative pool configurations and reports peak memory, fallback rate and malloc counts.
+//
+//	cgobytepool-replay -trace pool.trace -classes 512:1000,4096:1000 -classes 1024:500 -config tuned.json
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/octu0/cgobytepool"
+)
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+type namedConfig struct {
+	Name   string
+	Config cgobytepool.Config
+}
+
+type report struct {
+	Config string
+	cgobytepool.ReplayResult
+}
+
+func loadConfigs(configs, classes []string, alignment int) ([]namedConfig, error) {
+	result := make([]namedConfig, 0, len(configs)+len(classes))
+	for _, path := range configs {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := cgobytepool.LoadConfigJSON(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		result = append(result, namedConfig{filepath.Base(path), cfg})
+	}
+	for _, s := range classes {
+		c, err := cgobytepool.ParseClasses(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, namedConfig{s, cgobytepool.Config{Classes: c, Alignment: alignment}})
+	}
+	return result, nil
+}
+
+func writeTable(w io.Writer, reports []report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CONFIG\tPEAK_BYTES\tPEAK_OUTSTANDING\tGETS\tFALLBACKS\tFALLBACK_RATE\tMALLOCS\tFREES\t")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.2f%%\t%d\t%d\t\n",
+			r.Config,
+			r.PeakBytes,
+			r.PeakOutstanding,
+			r.Gets,
+			r.Fallbacks,
+			r.FallbackRate*100,
+			r.Mallocs,
+			r.Frees,
+		)
+	}
+	return tw.Flush()
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("cgobytepool-replay", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+
+	tracePath := fs.String("trace", "", "trace file recorded by cgobytepool.WithRecorder")
+	configs := stringsFlag{}
+	fs.Var(&configs, "config", "JSON config file of cgobytepool.Config (repeatable)")
+	classes := stringsFlag{}
+	fs.Var(&classes, "classes", "size classes bufferSize:poolSize,... (repeatable)")
+	alignment := fs.Int("alignment", 0, "alignment of -classes, 0 means cgobytepool.DefaultMemoryAlignmentFunc")
+	asJSON := fs.Bool("json", false, "output JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *tracePath == "" {
+		return errors.New("-trace is required")
+	}
+
+	cfgs, err := loadConfigs(configs, classes, *alignment)
+	if err != nil {
+		return err
+	}
+	if len(cfgs) == 0 {
+		return errors.New("-config or -classes is required")
+	}
+
+	f, err := os.Open(*tracePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	events, err := cgobytepool.ReadTrace(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *tracePath, err)
+	}
+
+	reports := make([]report, len(cfgs))
+	for i, c := range cfgs {
+		r, err := cgobytepool.Replay(events, c.Config)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.Name, err)
+		}
+		reports[i] = report{c.Name, r}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+	return writeTable(stdout, reports)
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
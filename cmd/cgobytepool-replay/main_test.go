@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/octu0/cgobytepool"
+)
+
+func writeTrace(t *testing.T, dir string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "pool.trace")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer f.Close()
+
+	p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc, cgobytepool.WithPoolSize(10, 512), cgobytepool.WithRecorder(f))
+	for i := 0; i < 100; i += 1 {
+		ptr1 := p.Get(100)
+		ptr2 := p.Get(4000)
+		p.Put(ptr1, 100)
+		p.Put(ptr2, 4000)
+	}
+	p.Close()
+	return path
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	tracePath := writeTrace(t, dir)
+
+	configPath := filepath.Join(dir, "tuned.json")
+	os.WriteFile(configPath, []byte(`{"classes":[{"buffer_size":512,"pool_size":10},{"buffer_size":4096,"pool_size":10}]}`), 0644)
+
+	t.Run("table", func(tt *testing.T) {
+		out := bytes.NewBuffer(nil)
+		if err := run([]string{"-trace", tracePath, "-classes", "512:10", "-config", configPath}, out); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 3 {
+			tt.Fatalf("expect header and 2 rows actual=%s", out.String())
+		}
+		if strings.Contains(lines[1], "tuned.json") != true || strings.Contains(lines[2], "512:10") != true {
+			tt.Errorf("config file first, then classes: %s", out.String())
+		}
+	})
+	t.Run("json", func(tt *testing.T) {
+		out := bytes.NewBuffer(nil)
+		if err := run([]string{"-trace", tracePath, "-json", "-classes", "512:10", "-config", configPath}, out); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		reports := []report{}
+		if err := json.Unmarshal(out.Bytes(), &reports); err != nil {
+			tt.Fatalf("%+v", err)
+		}
+		if reports[0].Gets != 200 || reports[1].Gets != 200 {
+			tt.Errorf("expect 200 gets actual=%+v", reports)
+		}
+		if reports[0].Fallbacks != 0 {
+			tt.Errorf("tuned has no fallback actual=%d", reports[0].Fallbacks)
+		}
+		if reports[1].Fallbacks != 100 || reports[1].FallbackRate != 0.5 {
+			tt.Errorf("512 only falls back for 4000 bytes actual=%d", reports[1].Fallbacks)
+		}
+	})
+	t.Run("errors", func(tt *testing.T) {
+		for _, args := range [][]string{
+			{},
+			{"-trace", tracePath},
+			{"-trace", filepath.Join(dir, "missing"), "-classes", "512:1"},
+			{"-trace", configPath, "-classes", "512:1"},
+			{"-trace", tracePath, "-classes", "x"},
+			{"-trace", tracePath, "-config", filepath.Join(dir, "missing.json")},
+		} {
+			if err := run(args, bytes.NewBuffer(nil)); err == nil {
+				tt.Errorf("%v must be error", args)
+			}
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package cgobytepool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// environment variables read by LoadConfigEnv
+const (
+	EnvName             string = "CGOBYTEPOOL_NAME"
+	EnvClasses          string = "CGOBYTEPOOL_CLASSES" // bufferSize:poolSize,... e.g. 512:1000,4096:1000
+	EnvAlignment        string = "CGOBYTEPOOL_ALIGNMENT"
+	EnvMemoryBudget     string = "CGOBYTEPOOL_MEMORY_BUDGET"
+	EnvScavengeInterval string = "CGOBYTEPOOL_SCAVENGE_INTERVAL"
+	EnvScavengeIdleTTL  string = "CGOBYTEPOOL_SCAVENGE_IDLE_TTL"
+	EnvProfileRate      string = "CGOBYTEPOOL_PROFILE_RATE"
+	EnvRuntimeTrace     string = "CGOBYTEPOOL_RUNTIME_TRACE"
+)
+
+type ClassConfig struct {
+	BufferSize int `json:"buffer_size"`
+	PoolSize   int `json:"pool_size"`
+	Prealloc   int `json:"prealloc,omitempty"` // buffers allocated at NewPool
+}
+
+// Duration is time.Duration that is encoded as string (e.g. "30s") in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	s := ""
+	if err := json.Unmarshal(data, &s); err != nil {
+		// nanoseconds
+		n := int64(0)
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("cgobytepool: invalid duration %s", data)
+		}
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("cgobytepool: invalid duration %q: %w", s, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config describes a pool declaratively, see NewPoolFromConfig.
+type Config struct {
+	Name         string        `json:"name,omitempty"`
+	Classes      []ClassConfig `json:"classes"`
+	Alignment    int           `json:"alignment,omitempty"`     // round up to multiple of Alignment, 0 means DefaultMemoryAlignmentFunc
+	MemoryBudget int64         `json:"memory_budget,omitempty"` // 0 means unlimited
+	Prefault     bool          `json:"prefault,omitempty"`      // touch pages of preallocated buffers
+	Scavenger    struct {
+		Interval Duration `json:"interval,omitempty"` // 0 means disabled
+		IdleTTL  Duration `json:"idle_ttl,omitempty"`
+	} `json:"scavenger"`
+	WarmupProfile struct {
+		Path   string   `json:"path,omitempty"`
+		MaxAge Duration `json:"max_age,omitempty"` // 0 means no limit
+	} `json:"warmup_profile"`
+	Debug struct {
+		ProfileRate  int  `json:"profile_rate,omitempty"`
+		RuntimeTrace bool `json:"runtime_trace,omitempty"`
+	} `json:"debug"`
+}
+
+func (c Config) validate() error {
+	for i, cls := range c.Classes {
+		if cls.BufferSize <= 0 {
+			return fmt.Errorf("cgobytepool: classes[%d] buffer size must be positive: %d", i, cls.BufferSize)
+		}
+		if cls.PoolSize < 0 {
+			return fmt.Errorf("cgobytepool: classes[%d] pool size must not be negative: %d", i, cls.PoolSize)
+		}
+		if cls.Prealloc < 0 {
+			return fmt.Errorf("cgobytepool: classes[%d] prealloc must not be negative: %d", i, cls.Prealloc)
+		}
+	}
+	if c.Alignment < 0 {
+		return fmt.Errorf("cgobytepool: alignment must not be negative: %d", c.Alignment)
+	}
+	if c.Scavenger.Interval < 0 || c.Scavenger.IdleTTL < 0 || c.WarmupProfile.MaxAge < 0 {
+		return fmt.Errorf("cgobytepool: durations must not be negative")
+	}
+	if c.Debug.ProfileRate < 0 {
+		return fmt.Errorf("cgobytepool: profile rate must not be negative: %d", c.Debug.ProfileRate)
+	}
+	return nil
+}
+
+// PoolFuncs returns the options of NewPool that c describes.
+func (c Config) PoolFuncs() []WithPoolFunc {
+	funcs := make([]WithPoolFunc, 0, len(c.Classes)*2+8)
+	for _, cls := range c.Classes {
+		funcs = append(funcs, WithPoolSize(cls.PoolSize, cls.BufferSize))
+		if 0 < cls.Prealloc {
+			funcs = append(funcs, WithPrealloc(cls.Prealloc, cls.BufferSize))
+		}
+	}
+	if c.Prefault {
+		funcs = append(funcs, WithPrefault())
+	}
+	if c.WarmupProfile.Path != "" {
+		funcs = append(funcs, WithWarmupProfile(c.WarmupProfile.Path, time.Duration(c.WarmupProfile.MaxAge)))
+	}
+	if c.Name != "" {
+		funcs = append(funcs, WithName(c.Name))
+	}
+	if 0 < c.MemoryBudget {
+		funcs = append(funcs, WithMemoryBudget(c.MemoryBudget))
+	}
+	if 0 < c.Scavenger.Interval {
+		funcs = append(funcs, WithScavenger(time.Duration(c.Scavenger.Interval), time.Duration(c.Scavenger.IdleTTL)))
+	}
+	if 0 < c.Debug.ProfileRate {
+		funcs = append(funcs, WithProfileRate(c.Debug.ProfileRate))
+	}
+	if c.Debug.RuntimeTrace {
+		funcs = append(funcs, WithRuntimeTrace())
+	}
+	return funcs
+}
+
+// AlignmentFunc returns MemoryAligmentFunc of c.Alignment.
+func (c Config) AlignmentFunc() MemoryAligmentFunc {
+	if c.Alignment <= 0 {
+		return DefaultMemoryAlignmentFunc
+	}
+	align := c.Alignment
+	return func(n int) int {
+		return ((n + align - 1) / align) * align
+	}
+}
+
+// NewPoolFromConfig validates cfg and creates pool, extra options are applied after cfg.
+func NewPoolFromConfig(cfg Config, poolFuncs ...WithPoolFunc) (*CgoBytePool, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return newPool(cfg.AlignmentFunc(), append(cfg.PoolFuncs(), poolFuncs...)...)
+}
+
+// ParseClasses parses size classes of "bufferSize:poolSize,..." (e.g. "512:1000,4096:1000").
+func ParseClasses(s string) ([]ClassConfig, error) {
+	classes := make([]ClassConfig, 0)
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		bufSize, poolSize, ok := strings.Cut(c, ":")
+		if ok != true {
+			return nil, fmt.Errorf("cgobytepool: invalid class %q, expect bufferSize:poolSize", c)
+		}
+		b, err := strconv.Atoi(strings.TrimSpace(bufSize))
+		if err != nil {
+			return nil, fmt.Errorf("cgobytepool: invalid buffer size of class %q: %w", c, err)
+		}
+		p, err := strconv.Atoi(strings.TrimSpace(poolSize))
+		if err != nil {
+			return nil, fmt.Errorf("cgobytepool: invalid pool size of class %q: %w", c, err)
+		}
+		classes = append(classes, ClassConfig{BufferSize: b, PoolSize: p})
+	}
+	return classes, nil
+}
+
+// LoadConfigJSON decodes Config from r.
+func LoadConfigJSON(r io.Reader) (Config, error) {
+	cfg := Config{}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("cgobytepool: decode config: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadConfigEnv overrides base with CGOBYTEPOOL_* environment variables that are set.
+func LoadConfigEnv(base Config) (Config, error) {
+	cfg := base
+	if v, ok := os.LookupEnv(EnvName); ok {
+		cfg.Name = v
+	}
+	if v, ok := os.LookupEnv(EnvClasses); ok {
+		classes, err := ParseClasses(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", EnvClasses, err)
+		}
+		cfg.Classes = classes
+	}
+	if err := lookupEnvInt(EnvAlignment, &cfg.Alignment); err != nil {
+		return Config{}, err
+	}
+	if v, ok := os.LookupEnv(EnvMemoryBudget); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", EnvMemoryBudget, err)
+		}
+		cfg.MemoryBudget = n
+	}
+	if err := lookupEnvDuration(EnvScavengeInterval, &cfg.Scavenger.Interval); err != nil {
+		return Config{}, err
+	}
+	if err := lookupEnvDuration(EnvScavengeIdleTTL, &cfg.Scavenger.IdleTTL); err != nil {
+		return Config{}, err
+	}
+	if err := lookupEnvInt(EnvProfileRate, &cfg.Debug.ProfileRate); err != nil {
+		return Config{}, err
+	}
+	if v, ok := os.LookupEnv(EnvRuntimeTrace); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", EnvRuntimeTrace, err)
+		}
+		cfg.Debug.RuntimeTrace = b
+	}
+
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func lookupEnvInt(key string, out *int) error {
+	v, ok := os.LookupEnv(key)
+	if ok != true {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*out = n
+	return nil
+}
+
+func lookupEnvDuration(key string, out *Duration) error {
+	v, ok := os.LookupEnv(key)
+	if ok != true {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*out = Duration(d)
+	return nil
+}
@@ -0,0 +1,276 @@
+package cgobytepool
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseClasses(t *testing.T) {
+	t.Run("ok", func(tt *testing.T) {
+		classes, err := ParseClasses("512:1000, 4096:100,")
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if len(classes) != 2 {
+			tt.Fatalf("expect 2 classes actual=%d", len(classes))
+		}
+		if classes[0] != (ClassConfig{BufferSize: 512, PoolSize: 1000}) {
+			tt.Errorf("classes[0] actual=%+v", classes[0])
+		}
+		if classes[1] != (ClassConfig{BufferSize: 4096, PoolSize: 100}) {
+			tt.Errorf("classes[1] actual=%+v", classes[1])
+		}
+	})
+	t.Run("empty", func(tt *testing.T) {
+		classes, err := ParseClasses("")
+		if err != nil || len(classes) != 0 {
+			tt.Errorf("empty expect no classes actual=%v %+v", classes, err)
+		}
+	})
+	t.Run("invalid", func(tt *testing.T) {
+		for _, s := range []string{"512", "a:100", "512:b", "512:100:1"} {
+			if _, err := ParseClasses(s); err == nil {
+				tt.Errorf("%q must be error", s)
+			}
+		}
+	})
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	t.Run("file", func(tt *testing.T) {
+		f, err := os.Open("testdata/config/pool.json")
+		if err != nil {
+			tt.Fatalf("%+v", err)
+		}
+		defer f.Close()
+
+		cfg, err := LoadConfigJSON(f)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if cfg.Name != "test-config-file" || len(cfg.Classes) != 2 || cfg.Alignment != 64 || cfg.MemoryBudget != 1048576 {
+			tt.Errorf("decoded %+v", cfg)
+		}
+		if time.Duration(cfg.Scavenger.Interval) != 30*time.Second || time.Duration(cfg.Scavenger.IdleTTL) != 5*time.Minute {
+			tt.Errorf("durations %+v", cfg.Scavenger)
+		}
+		if cfg.Debug.ProfileRate != 524288 || cfg.Debug.RuntimeTrace != true {
+			tt.Errorf("debug %+v", cfg.Debug)
+		}
+	})
+	t.Run("nanoseconds", func(tt *testing.T) {
+		cfg, err := LoadConfigJSON(strings.NewReader(`{"scavenger":{"interval":1000000000}}`))
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if time.Duration(cfg.Scavenger.Interval) != time.Second {
+			tt.Errorf("expect 1s actual=%s", time.Duration(cfg.Scavenger.Interval))
+		}
+	})
+	t.Run("invalid", func(tt *testing.T) {
+		for _, s := range []string{
+			`{"unknown": 1}`,
+			`{"classes":[{"buffer_size":0,"pool_size":1}]}`,
+			`{"scavenger":{"interval":"soon"}}`,
+			`{"alignment":-1}`,
+		} {
+			if _, err := LoadConfigJSON(strings.NewReader(s)); err == nil {
+				tt.Errorf("%s must be error", s)
+			}
+		}
+	})
+	t.Run("roundtrip", func(tt *testing.T) {
+		cfg := Config{Classes: []ClassConfig{{BufferSize: 64, PoolSize: 1}}}
+		cfg.Scavenger.Interval = Duration(time.Minute)
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			tt.Fatalf("%+v", err)
+		}
+		if strings.Contains(string(data), `"interval":"1m0s"`) != true {
+			tt.Errorf("duration encoded as string: %s", data)
+		}
+		decoded, err := LoadConfigJSON(strings.NewReader(string(data)))
+		if err != nil {
+			tt.Fatalf("%+v", err)
+		}
+		if decoded.Scavenger.Interval != cfg.Scavenger.Interval || decoded.Classes[0] != cfg.Classes[0] {
+			tt.Errorf("roundtrip %+v", decoded)
+		}
+	})
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	t.Run("override", func(tt *testing.T) {
+		tt.Setenv(EnvClasses, "512:1000,4096:1000")
+		tt.Setenv(EnvMemoryBudget, "2048")
+		tt.Setenv(EnvScavengeInterval, "10s")
+		tt.Setenv(EnvRuntimeTrace, "true")
+
+		base := Config{Name: "base", Alignment: 8}
+		cfg, err := LoadConfigEnv(base)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if cfg.Name != "base" || cfg.Alignment != 8 {
+			tt.Errorf("unset env keeps base %+v", cfg)
+		}
+		if len(cfg.Classes) != 2 || cfg.Classes[1].BufferSize != 4096 {
+			tt.Errorf("classes %+v", cfg.Classes)
+		}
+		if cfg.MemoryBudget != 2048 || time.Duration(cfg.Scavenger.Interval) != 10*time.Second || cfg.Debug.RuntimeTrace != true {
+			tt.Errorf("env %+v", cfg)
+		}
+	})
+	t.Run("invalid", func(tt *testing.T) {
+		for key, value := range map[string]string{
+			EnvClasses:          "512",
+			EnvAlignment:        "x",
+			EnvMemoryBudget:     "1GB",
+			EnvScavengeIdleTTL:  "1",
+			EnvProfileRate:      "-1",
+			EnvRuntimeTrace:     "maybe",
+			EnvScavengeInterval: "-1s",
+		} {
+			tt.Run(key, func(ttt *testing.T) {
+				ttt.Setenv(key, value)
+				if _, err := LoadConfigEnv(Config{}); err == nil {
+					ttt.Errorf("%s=%s must be error", key, value)
+				}
+			})
+		}
+	})
+}
+
+func TestNewPoolFromConfig(t *testing.T) {
+	t.Run("pool", func(tt *testing.T) {
+		cfg := Config{
+			Name:         "test-config",
+			Classes:      []ClassConfig{{BufferSize: 4000, PoolSize: 10}, {BufferSize: 500, PoolSize: 100}},
+			Alignment:    512,
+			MemoryBudget: 1024 * 1024,
+		}
+		cfg.Scavenger.Interval = Duration(time.Hour)
+		cfg.Scavenger.IdleTTL = Duration(time.Hour)
+
+		p, err := NewPoolFromConfig(cfg)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		defer p.Close()
+
+		if len(p.pools) != 2 || p.pools[0].bufSize != 512 || p.pools[1].bufSize != 4096 {
+			tt.Errorf("classes aligned to 512 actual=%d,%d", p.pools[0].bufSize, p.pools[1].bufSize)
+		}
+		if p.pools[0].Cap() != 100 {
+			tt.Errorf("pool size actual=%d", p.pools[0].Cap())
+		}
+		if p.MemoryBudget() != 1024*1024 {
+			tt.Errorf("budget actual=%d", p.MemoryBudget())
+		}
+		if p.scavenger == nil {
+			tt.Errorf("scavenger enabled")
+		}
+		if found, _ := Lookup("test-config"); found != Pool(p) {
+			tt.Errorf("registered by name")
+		}
+
+		if _, err := NewPoolFromConfig(cfg); errors.Is(err, ErrDuplicateName) != true {
+			tt.Errorf("duplicate name expect ErrDuplicateName actual=%+v", err)
+		}
+	})
+	t.Run("concurrent_duplicate", func(tt *testing.T) {
+		cfg := Config{Name: "test-config-concurrent"}
+
+		pools := make(chan *CgoBytePool, 16)
+		errs := make(chan error, 16)
+		wg := new(sync.WaitGroup)
+		for i := 0; i < 16; i += 1 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				p, err := NewPoolFromConfig(cfg)
+				if err != nil {
+					errs <- err
+					return
+				}
+				pools <- p
+			}()
+		}
+		wg.Wait()
+		close(pools)
+		close(errs)
+
+		if len(pools) != 1 {
+			tt.Errorf("only one pool is created actual=%d", len(pools))
+		}
+		for p := range pools {
+			p.Close()
+		}
+		for err := range errs {
+			if errors.Is(err, ErrDuplicateName) != true {
+				tt.Errorf("expect ErrDuplicateName actual=%+v", err)
+			}
+		}
+	})
+	t.Run("invalid", func(tt *testing.T) {
+		cfg := Config{Classes: []ClassConfig{{BufferSize: -1, PoolSize: 1}}}
+		if _, err := NewPoolFromConfig(cfg); err == nil {
+			tt.Errorf("must be error")
+		}
+	})
+	t.Run("default", func(tt *testing.T) {
+		p, err := NewPoolFromConfig(Config{})
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		defer p.Close()
+
+		if p.scavenger != nil || p.profiler != nil || p.trace {
+			tt.Errorf("zero Config has no options")
+		}
+		if p.alignFunc(100) != DefaultMemoryAlignmentFunc(100) {
+			tt.Errorf("default alignment")
+		}
+	})
+}
+
+func TestConfigPrealloc(t *testing.T) {
+	cfg, err := LoadConfigJSON(strings.NewReader(`{"classes":[{"buffer_size":512,"pool_size":10,"prealloc":4}],"prefault":true}`))
+	if err != nil {
+		t.Fatalf("no error: %+v", err)
+	}
+	p, err := NewPoolFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("no error: %+v", err)
+	}
+	defer p.Close()
+
+	if p.pools[0].Len() != 4 {
+		t.Errorf("expect 4 preallocated actual=%d", p.pools[0].Len())
+	}
+	if p.prefault != true {
+		t.Errorf("prefault enabled")
+	}
+	if _, err := LoadConfigJSON(strings.NewReader(`{"classes":[{"buffer_size":512,"pool_size":10,"prealloc":-1}]}`)); err == nil {
+		t.Errorf("negative prealloc must be error")
+	}
+}
+
+func TestConfigWarmupProfile(t *testing.T) {
+	cfg, err := LoadConfigJSON(strings.NewReader(`{"classes":[{"buffer_size":512,"pool_size":10}],"warmup_profile":{"path":"/tmp/warmup.json","max_age":"24h"}}`))
+	if err != nil {
+		t.Fatalf("no error: %+v", err)
+	}
+	if cfg.WarmupProfile.Path != "/tmp/warmup.json" || time.Duration(cfg.WarmupProfile.MaxAge) != 24*time.Hour {
+		t.Errorf("decoded %+v", cfg.WarmupProfile)
+	}
+	if _, err := LoadConfigJSON(strings.NewReader(`{"warmup_profile":{"max_age":"-1h"}}`)); err == nil {
+		t.Errorf("negative max_age must be error")
+	}
+}
@@ -0,0 +1,239 @@
+package cgobytepool
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+var (
+	_ http.Handler = (*DebugHandler)(nil)
+)
+
+type debugPool struct {
+	Name        string
+	Stats       PoolStats
+	Outstanding []OutstandingAlloc `json:",omitempty"` // nil unless tracked (e.g. WithChecks)
+}
+
+type debugActionResult struct {
+	Name   string
+	Action string
+	Freed  int64 `json:",omitempty"`
+}
+
+var debugTemplate = template.Must(template.New("cgobytepool").Parse(`<!DOCTYPE html>
+<html>
+<head><title>cgobytepool</title></head>
+<body>
+<h1>cgobytepool</h1>
+<p><a href="?format=json">json</a></p>
+{{range .}}
+<h2>{{.Name}}{{if .Stats.Closed}} (closed){{end}}</h2>
+<form method="post">
+<input type="hidden" name="name" value="{{.Name}}">
+<button name="action" value="trim">Trim</button>
+<button name="action" value="reset">Reset counters</button>
+</form>
+<table border="1">
+<tr><th>class</th><th>bytes</th><th>idle</th><th>cap</th></tr>
+{{range .Stats.Allocs}}<tr><td>{{.ID}}</td><td>{{.Size}}</td><td>{{.Len}}</td><td>{{.Cap}}</td></tr>
+{{end}}<tr><td>fallback</td><td>{{.Stats.Fallback.Size}}</td><td></td><td></td></tr>
+</table>
+<p>outstanding: {{.Stats.Outstanding.Count}} ({{.Stats.Outstanding.Fallbacks}} fallbacks)</p>
+<p>gets: {{.Stats.Counters.Gets}} puts: {{.Stats.Counters.Puts}} mallocs: {{.Stats.Counters.Mallocs}} frees: {{.Stats.Counters.Frees}}</p>
+{{if .Outstanding}}
+<table border="1">
+<tr><th>ptr</th><th>size</th></tr>
+{{range .Outstanding}}<tr><td>{{printf "%#x" .Ptr}}</td><td>{{.Size}}</td></tr>
+{{end}}</table>
+{{end}}
+{{else}}
+<p>no pools</p>
+{{end}}
+</body>
+</html>
+`))
+
+// DebugHandler serves the PoolStats of the pools in the global registry (see WithName)
+// and the pools added by Register, like net/http/pprof.
+//
+//	p := cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc, cgobytepool.WithName("codec"))
+//	http.Handle("/debug/cgobytepool", cgobytepool.NewDebugHandler())
+//
+// GET renders HTML, or JSON with ?format=json.
+// POST with form values name and action=trim|reset calls Trim or ResetCounters of the pool.
+// Cross-origin POST from browsers (Sec-Fetch-Site or Origin) is rejected, but requests without
+// those headers (e.g. curl) are not authenticated, so mount it only on an internal mux.
+type DebugHandler struct {
+	mutex    *sync.Mutex
+	pools    map[string]Pool
+	registry *poolRegistry
+}
+
+// Register adds p to the handler only under name, it takes precedence over the global registry.
+func (h *DebugHandler) Register(name string, p Pool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.pools[name] = p
+}
+
+func (h *DebugHandler) Unregister(name string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.pools, name)
+}
+
+func (h *DebugHandler) lookup(name string) (Pool, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if p, ok := h.pools[name]; ok {
+		return p, true
+	}
+	return h.registry.lookup(name)
+}
+
+func (h *DebugHandler) snapshot() []debugPool {
+	names, pools := h.registry.snapshot()
+	h.mutex.Lock()
+	for name, p := range h.pools {
+		if _, ok := pools[name]; ok != true {
+			names = append(names, name)
+		}
+		pools[name] = p
+	}
+	h.mutex.Unlock()
+
+	sort.Strings(names)
+	result := make([]debugPool, len(names))
+	for i, name := range names {
+		p := pools[name]
+		result[i] = debugPool{
+			Name:        name,
+			Stats:       p.Stats(),
+			Outstanding: nil,
+		}
+		if l, ok := findPool[OutstandingAllocsLister](p); ok {
+			result[i].Outstanding = l.OutstandingAllocs()
+		}
+	}
+	return result
+}
+
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.serveStats(w, r)
+	case http.MethodPost:
+		h.serveAction(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *DebugHandler) serveStats(w http.ResponseWriter, r *http.Request) {
+	pools := h.snapshot()
+	if r.FormValue("format") == "json" {
+		writeDebugJSON(w, pools)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	debugTemplate.Execute(w, pools)
+}
+
+// sameOrigin reports whether r is not a cross-origin request from a browser,
+// a form on another site can POST to the handler without preflight.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+		// older browsers, or not a browser
+	default:
+		return false // cross-site or same-site
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+func (h *DebugHandler) serveAction(w http.ResponseWriter, r *http.Request) {
+	if sameOrigin(r) != true {
+		http.Error(w, "cross-origin request", http.StatusForbidden)
+		return
+	}
+
+	name, action := r.FormValue("name"), r.FormValue("action")
+	p, ok := h.lookup(name)
+	if ok != true {
+		http.Error(w, "pool not found: "+name, http.StatusNotFound)
+		return
+	}
+
+	result := debugActionResult{Name: name, Action: action, Freed: 0}
+	switch action {
+	case "trim":
+		t, ok := findPool[interface{ Trim() int64 }](p)
+		if ok != true {
+			http.Error(w, "pool does not support trim: "+name, http.StatusBadRequest)
+			return
+		}
+		result.Freed = t.Trim()
+	case "reset":
+		c, ok := findPool[interface{ ResetCounters() }](p)
+		if ok != true {
+			http.Error(w, "pool does not support reset: "+name, http.StatusBadRequest)
+			return
+		}
+		c.ResetCounters()
+	default:
+		http.Error(w, "unknown action: "+action, http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("format") == "json" {
+		writeDebugJSON(w, result)
+		return
+	}
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+func writeDebugJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// findPool returns p or the first pool wrapped by decorators of p that implements T.
+func findPool[T any](p Pool) (T, bool) {
+	for p != nil {
+		if v, ok := p.(T); ok {
+			return v, true
+		}
+		p = Unwrap(p)
+	}
+	var zero T
+	return zero, false
+}
+
+func NewDebugHandler() *DebugHandler {
+	return &DebugHandler{
+		mutex:    new(sync.Mutex),
+		pools:    make(map[string]Pool),
+		registry: defaultPoolRegistry,
+	}
+}
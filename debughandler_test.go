@@ -0,0 +1,225 @@
+package cgobytepool
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	newHandler := func() (*DebugHandler, *CgoBytePool) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 64))
+		h := NewDebugHandler()
+		h.Register("codec", p)
+		return h, p
+	}
+
+	t.Run("html", func(tt *testing.T) {
+		h, p := newHandler()
+		defer p.Close()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cgobytepool", nil))
+		if rec.Code != http.StatusOK {
+			tt.Errorf("expect 200 actual=%d", rec.Code)
+		}
+		if strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") != true {
+			tt.Errorf("expect html actual=%s", rec.Header().Get("Content-Type"))
+		}
+		if strings.Contains(rec.Body.String(), "<h2>codec</h2>") != true {
+			tt.Errorf("pool name must be rendered: %s", rec.Body.String())
+		}
+	})
+	t.Run("json", func(tt *testing.T) {
+		h, p := newHandler()
+		defer p.Close()
+
+		ptr := p.Get(64)
+		defer p.Put(ptr, 64)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cgobytepool?format=json", nil))
+		pools := []debugPool{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &pools); err != nil {
+			tt.Fatalf("json: %+v", err)
+		}
+		if len(pools) != 1 || pools[0].Name != "codec" {
+			tt.Fatalf("expect codec actual=%+v", pools)
+		}
+		if pools[0].Stats.Outstanding.Count != 1 {
+			tt.Errorf("expect 1 outstanding actual=%d", pools[0].Stats.Outstanding.Count)
+		}
+		if pools[0].Outstanding != nil {
+			tt.Errorf("not tracked without WithChecks")
+		}
+	})
+	t.Run("outstanding", func(tt *testing.T) {
+		inner := NewPool(DefaultMemoryAlignmentFunc)
+		defer inner.Close()
+
+		p := WithLimit(WithChecks(inner), 10)
+		h := NewDebugHandler()
+		h.Register("checked", p)
+
+		ptr := p.Get(100)
+		defer p.Put(ptr, 100)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?format=json", nil))
+		pools := []debugPool{}
+		json.Unmarshal(rec.Body.Bytes(), &pools)
+		if len(pools[0].Outstanding) != 1 {
+			tt.Fatalf("expect 1 outstanding alloc actual=%+v", pools[0].Outstanding)
+		}
+		if pools[0].Outstanding[0].Ptr != uintptr(ptr) || pools[0].Outstanding[0].Size != 100 {
+			tt.Errorf("outstanding alloc mismatch %+v", pools[0].Outstanding[0])
+		}
+
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if strings.Contains(rec.Body.String(), "<td>100</td>") != true {
+			tt.Errorf("html must list outstanding allocs: %s", rec.Body.String())
+		}
+	})
+	t.Run("trim", func(tt *testing.T) {
+		h, p := newHandler()
+		defer p.Close()
+
+		ptr := p.Get(64)
+		p.Put(ptr, 64)
+
+		form := url.Values{"name": {"codec"}, "action": {"trim"}, "format": {"json"}}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		result := debugActionResult{}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		if result.Freed != int64(p.pools[0].bufSize) {
+			tt.Errorf("expect freed=%d actual=%+v", p.pools[0].bufSize, result)
+		}
+		if p.pools[0].Len() != 0 {
+			tt.Errorf("idle buffers must be trimmed")
+		}
+	})
+	t.Run("reset", func(tt *testing.T) {
+		h, p := newHandler()
+		defer p.Close()
+
+		ptr := p.Get(64)
+		p.Put(ptr, 64)
+
+		form := url.Values{"name": {"codec"}, "action": {"reset"}}
+		req := httptest.NewRequest(http.MethodPost, "/debug/cgobytepool", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusSeeOther {
+			tt.Errorf("html form redirects actual=%d", rec.Code)
+		}
+		st := p.Stats()
+		if st.Counters.Gets != 0 || st.Counters.Puts != 0 || st.Counters.Mallocs != 0 {
+			tt.Errorf("counters must be reset %+v", st.Counters)
+		}
+		if p.TotalAllocBytes() == 0 {
+			tt.Errorf("allocated bytes are kept")
+		}
+	})
+	t.Run("errors", func(tt *testing.T) {
+		h, p := newHandler()
+		defer p.Close()
+
+		post := func(form url.Values) int {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		if code := post(url.Values{"name": {"unknown"}, "action": {"trim"}}); code != http.StatusNotFound {
+			tt.Errorf("unknown pool expect 404 actual=%d", code)
+		}
+		if code := post(url.Values{"name": {"codec"}, "action": {"unknown"}}); code != http.StatusBadRequest {
+			tt.Errorf("unknown action expect 400 actual=%d", code)
+		}
+
+		h.Register("plain", plainPool{p})
+		if code := post(url.Values{"name": {"plain"}, "action": {"trim"}}); code != http.StatusBadRequest {
+			tt.Errorf("unsupported action expect 400 actual=%d", code)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			tt.Errorf("expect 405 actual=%d", rec.Code)
+		}
+	})
+	t.Run("cross_origin", func(tt *testing.T) {
+		h, p := newHandler()
+		defer p.Close()
+
+		post := func(headers map[string]string) int {
+			form := url.Values{"name": {"codec"}, "action": {"reset"}}
+			req := httptest.NewRequest(http.MethodPost, "http://localhost:6060/debug/cgobytepool", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		for _, headers := range []map[string]string{
+			{"Sec-Fetch-Site": "cross-site"},
+			{"Sec-Fetch-Site": "same-site"},
+			{"Origin": "http://evil.example"},
+			{"Origin": "null"},
+		} {
+			if code := post(headers); code != http.StatusForbidden {
+				tt.Errorf("%v expect 403 actual=%d", headers, code)
+			}
+		}
+		for _, headers := range []map[string]string{
+			{},
+			{"Sec-Fetch-Site": "same-origin"},
+			{"Origin": "http://localhost:6060"},
+		} {
+			if code := post(headers); code != http.StatusSeeOther {
+				tt.Errorf("%v expect 303 actual=%d", headers, code)
+			}
+		}
+	})
+	t.Run("unregister", func(tt *testing.T) {
+		h, p := newHandler()
+		defer p.Close()
+
+		h.Unregister("codec")
+		if len(h.snapshot()) != 0 {
+			tt.Errorf("unregistered")
+		}
+	})
+}
+
+func TestResetCounters(t *testing.T) {
+	p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 64))
+	defer p.Close()
+
+	ptr1 := p.Get(64)
+	ptr2 := p.Get(1024)
+	p.ResetCounters()
+	p.Put(ptr1, 64)
+	p.Put(ptr2, 1024)
+
+	st := p.Stats()
+	if st.Counters.Gets != 0 || st.Counters.Puts != 2 || st.Counters.Mallocs != 0 || st.Counters.Frees != 1 {
+		t.Errorf("counted after reset only %+v", st.Counters)
+	}
+	if st.Outstanding.Count != 0 {
+		t.Errorf("outstanding is kept actual=%d", st.Outstanding.Count)
+	}
+}
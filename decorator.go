@@ -0,0 +1,361 @@
+package cgobytepool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+var (
+	ErrLimitExceeded = errors.New("cgobytepool: limit exceeded")
+)
+
+var (
+	_ Pool = (*limitPool)(nil)
+	_ Pool = (*tracingPool)(nil)
+	_ Pool = (*checkPool)(nil)
+	_ Pool = (*statsPool)(nil)
+	_ Pool = (*loggingPool)(nil)
+
+	_ OutstandingAllocsLister = (*checkPool)(nil)
+)
+
+type OutstandingAlloc struct {
+	Ptr  uintptr
+	Size int
+}
+
+// OutstandingAllocsLister is implemented by pools that track outstanding buffers (e.g. WithChecks).
+type OutstandingAllocsLister interface {
+	OutstandingAllocs() []OutstandingAlloc
+}
+
+// tryGetter is implemented by pools that can report why Get failed.
+type tryGetter interface {
+	TryGet(int) (unsafe.Pointer, error)
+}
+
+func poolTryGet(p Pool, size int) (unsafe.Pointer, error) {
+	if tp, ok := p.(tryGetter); ok {
+		return tp.TryGet(size)
+	}
+	ptr := p.Get(size)
+	if ptr == nil {
+		return nil, ErrAllocFailed
+	}
+	return ptr, nil
+}
+
+// Unwrap returns the Pool wrapped by decorator p, or nil if p is not a decorator.
+func Unwrap(p Pool) Pool {
+	if u, ok := p.(interface{ Unwrap() Pool }); ok {
+		return u.Unwrap()
+	}
+	return nil
+}
+
+type limitPool struct {
+	pool        Pool
+	max         int64
+	outstanding int64
+}
+
+func (p *limitPool) Get(size int) unsafe.Pointer {
+	ptr, _ := p.TryGet(size)
+	return ptr
+}
+
+func (p *limitPool) TryGet(size int) (unsafe.Pointer, error) {
+	if p.max < atomic.AddInt64(&p.outstanding, 1) {
+		atomic.AddInt64(&p.outstanding, -1)
+		return nil, ErrLimitExceeded
+	}
+	ptr, err := poolTryGet(p.pool, size)
+	if err != nil {
+		atomic.AddInt64(&p.outstanding, -1)
+		return nil, err
+	}
+	return ptr, nil
+}
+
+func (p *limitPool) Put(ptr unsafe.Pointer, size int) {
+	if ptr == nil {
+		return
+	}
+	p.pool.Put(ptr, size)
+	atomic.AddInt64(&p.outstanding, -1)
+}
+
+func (p *limitPool) Close() {
+	p.pool.Close()
+}
+
+func (p *limitPool) Stats() PoolStats {
+	return p.pool.Stats()
+}
+
+func (p *limitPool) Unwrap() Pool {
+	return p.pool
+}
+
+// WithLimit limits the number of outstanding buffers to max,
+// Get returns nil (TryGet returns ErrLimitExceeded) while the limit is reached.
+func WithLimit(p Pool, max int) Pool {
+	return &limitPool{
+		pool:        p,
+		max:         int64(max),
+		outstanding: 0,
+	}
+}
+
+type tracingPool struct {
+	pool Pool
+}
+
+func (p *tracingPool) Get(size int) unsafe.Pointer {
+	ptr, _ := p.TryGet(size)
+	return ptr
+}
+
+func (p *tracingPool) TryGet(size int) (unsafe.Pointer, error) {
+	region := traceStartRegion(true, traceRegionGet)
+	defer region.End()
+
+	ptr, err := poolTryGet(p.pool, size)
+	if err != nil {
+		traceLog(true, "get size=%d err=%s", size, err.Error())
+	}
+	return ptr, err
+}
+
+func (p *tracingPool) Put(ptr unsafe.Pointer, size int) {
+	region := traceStartRegion(true, traceRegionPut)
+	defer region.End()
+
+	p.pool.Put(ptr, size)
+}
+
+func (p *tracingPool) Close() {
+	traceLog(true, "close")
+	p.pool.Close()
+}
+
+func (p *tracingPool) Stats() PoolStats {
+	return p.pool.Stats()
+}
+
+func (p *tracingPool) Unwrap() Pool {
+	return p.pool
+}
+
+// WithTracing emits runtime/trace regions for every Get and Put of p.
+func WithTracing(p Pool) Pool {
+	return &tracingPool{
+		pool: p,
+	}
+}
+
+type checkPool struct {
+	pool  Pool
+	mutex *sync.Mutex
+	ptrs  map[uintptr]int // outstanding pointer -> size
+}
+
+func (p *checkPool) Get(size int) unsafe.Pointer {
+	ptr, _ := p.TryGet(size)
+	return ptr
+}
+
+func (p *checkPool) TryGet(size int) (unsafe.Pointer, error) {
+	ptr, err := poolTryGet(p.pool, size)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.ptrs[uintptr(ptr)]; ok {
+		panic(fmt.Sprintf("cgobytepool: Get returns outstanding pointer %p", ptr))
+	}
+	p.ptrs[uintptr(ptr)] = size
+	return ptr, nil
+}
+
+func (p *checkPool) Put(ptr unsafe.Pointer, size int) {
+	if ptr == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	getSize, ok := p.ptrs[uintptr(ptr)]
+	delete(p.ptrs, uintptr(ptr))
+	p.mutex.Unlock()
+
+	if ok != true {
+		panic(fmt.Sprintf("cgobytepool: Put of pointer %p not obtained from Get or already Put", ptr))
+	}
+	if getSize != size {
+		panic(fmt.Sprintf("cgobytepool: Put of pointer %p with size=%d, Get size=%d", ptr, size, getSize))
+	}
+	p.pool.Put(ptr, size)
+}
+
+// OutstandingAllocs returns the buffers taken by Get and not yet returned by Put, ordered by pointer.
+func (p *checkPool) OutstandingAllocs() []OutstandingAlloc {
+	p.mutex.Lock()
+	allocs := make([]OutstandingAlloc, 0, len(p.ptrs))
+	for ptr, size := range p.ptrs {
+		allocs = append(allocs, OutstandingAlloc{Ptr: ptr, Size: size})
+	}
+	p.mutex.Unlock()
+
+	sort.Slice(allocs, func(i, j int) bool {
+		return allocs[i].Ptr < allocs[j].Ptr
+	})
+	return allocs
+}
+
+func (p *checkPool) Close() {
+	p.pool.Close()
+}
+
+func (p *checkPool) Stats() PoolStats {
+	return p.pool.Stats()
+}
+
+func (p *checkPool) Unwrap() Pool {
+	return p.pool
+}
+
+// WithChecks tracks outstanding pointers of p and panics on double Put,
+// Put of a pointer not obtained from Get, or Put with a size different from Get.
+// Outstanding buffers are listed by OutstandingAllocs (see OutstandingAllocsLister).
+// Through the Handle bridge functions the panic is returned as ErrPoolPanic instead.
+func WithChecks(p Pool) Pool {
+	return &checkPool{
+		pool:  p,
+		mutex: new(sync.Mutex),
+		ptrs:  make(map[uintptr]int),
+	}
+}
+
+type statsPool struct {
+	pool        Pool
+	gets        int64
+	puts        int64
+	outstanding int64
+}
+
+func (p *statsPool) Get(size int) unsafe.Pointer {
+	ptr, _ := p.TryGet(size)
+	return ptr
+}
+
+func (p *statsPool) TryGet(size int) (unsafe.Pointer, error) {
+	ptr, err := poolTryGet(p.pool, size)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&p.gets, 1)
+	atomic.AddInt64(&p.outstanding, 1)
+	return ptr, nil
+}
+
+func (p *statsPool) Put(ptr unsafe.Pointer, size int) {
+	if ptr == nil {
+		return
+	}
+	p.pool.Put(ptr, size)
+	atomic.AddInt64(&p.puts, 1)
+	atomic.AddInt64(&p.outstanding, -1)
+}
+
+func (p *statsPool) Close() {
+	p.pool.Close()
+}
+
+// Stats returns Stats of the wrapped pool, with Counters.Gets, Counters.Puts and
+// Outstanding.Count counted by this decorator.
+func (p *statsPool) Stats() PoolStats {
+	st := p.pool.Stats()
+	st.Counters.Gets = atomic.LoadInt64(&p.gets)
+	st.Counters.Puts = atomic.LoadInt64(&p.puts)
+	st.Outstanding.Count = atomic.LoadInt64(&p.outstanding)
+	return st
+}
+
+func (p *statsPool) Unwrap() Pool {
+	return p.pool
+}
+
+// WithStats counts Get/Put and outstanding buffers of p, for Pool implementations
+// that do not report them in Stats.
+func WithStats(p Pool) Pool {
+	return &statsPool{
+		pool:        p,
+		gets:        0,
+		puts:        0,
+		outstanding: 0,
+	}
+}
+
+type loggingPool struct {
+	pool   Pool
+	logger *slog.Logger
+}
+
+func (p *loggingPool) Get(size int) unsafe.Pointer {
+	ptr, _ := p.TryGet(size)
+	return ptr
+}
+
+func (p *loggingPool) TryGet(size int) (unsafe.Pointer, error) {
+	ptr, err := poolTryGet(p.pool, size)
+	if err != nil {
+		p.logger.Warn("cgobytepool: get failed", slog.Int("size", size), slog.String("error", err.Error()))
+		return nil, err
+	}
+	if p.logger.Enabled(context.Background(), slog.LevelDebug) {
+		p.logger.Debug("cgobytepool: get", slog.Int("size", size), slog.String("ptr", fmt.Sprintf("%p", ptr)))
+	}
+	return ptr, nil
+}
+
+func (p *loggingPool) Put(ptr unsafe.Pointer, size int) {
+	if p.logger.Enabled(context.Background(), slog.LevelDebug) {
+		p.logger.Debug("cgobytepool: put", slog.Int("size", size), slog.String("ptr", fmt.Sprintf("%p", ptr)))
+	}
+	p.pool.Put(ptr, size)
+}
+
+func (p *loggingPool) Close() {
+	st := p.pool.Stats()
+	p.logger.Info("cgobytepool: close", slog.Int64("outstanding", st.Outstanding.Count))
+	p.pool.Close()
+}
+
+func (p *loggingPool) Stats() PoolStats {
+	return p.pool.Stats()
+}
+
+func (p *loggingPool) Unwrap() Pool {
+	return p.pool
+}
+
+// WithLogging logs Get and Put of p at debug level, failures at warn and Close at info.
+// If logger is nil, slog.Default is used.
+func WithLogging(p Pool, logger *slog.Logger) Pool {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &loggingPool{
+		pool:   p,
+		logger: logger,
+	}
+}
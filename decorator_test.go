@@ -0,0 +1,208 @@
+package cgobytepool
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+type plainPool struct {
+	Pool
+}
+
+func mustPanic(t *testing.T, name string, fn func()) {
+	t.Helper()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s must panic", name)
+		}
+	}()
+	fn()
+}
+
+func TestWithLimit(t *testing.T) {
+	t.Run("limit", func(tt *testing.T) {
+		p := WithLimit(NewPool(DefaultMemoryAlignmentFunc), 2)
+		defer p.Close()
+
+		ptr1 := p.Get(10)
+		ptr2 := p.Get(10)
+		if ptr1 == nil || ptr2 == nil {
+			tt.Fatalf("under limit must succeed")
+		}
+		if _, err := p.(tryGetter).TryGet(10); errors.Is(err, ErrLimitExceeded) != true {
+			tt.Errorf("over limit expect ErrLimitExceeded actual=%+v", err)
+		}
+		p.Put(ptr1, 10)
+		ptr3 := p.Get(10)
+		if ptr3 == nil {
+			tt.Errorf("after Put must succeed")
+		}
+		p.Put(ptr2, 10)
+		p.Put(ptr3, 10)
+	})
+	t.Run("failed_get", func(tt *testing.T) {
+		inner := NewPool(DefaultMemoryAlignmentFunc)
+		p := WithLimit(inner, 1)
+		inner.Close()
+
+		if _, err := p.(tryGetter).TryGet(10); errors.Is(err, ErrPoolClosed) != true {
+			tt.Errorf("error of inner pool expect ErrPoolClosed actual=%+v", err)
+		}
+		if n := p.(*limitPool).outstanding; n != 0 {
+			tt.Errorf("failed Get must not count actual=%d", n)
+		}
+	})
+	t.Run("handle", func(tt *testing.T) {
+		p := WithLimit(NewPool(DefaultMemoryAlignmentFunc), 1)
+		defer p.Close()
+
+		h := CgoHandle(p)
+		defer h.Release()
+
+		ptr, err := HandlePoolTryGetByValue(uintptr(h), 10)
+		if err != nil {
+			tt.Fatalf("no error %+v", err)
+		}
+		_, err = HandlePoolTryGetByValue(uintptr(h), 10)
+		if HandleErrorCode(err) != HandleErrLimit {
+			tt.Errorf("expect HandleErrLimit actual=%d", HandleErrorCode(err))
+		}
+		HandlePoolPutByValue(uintptr(h), ptr, 10)
+	})
+}
+
+func TestWithChecks(t *testing.T) {
+	t.Run("ok", func(tt *testing.T) {
+		p := WithChecks(NewPool(DefaultMemoryAlignmentFunc))
+		defer p.Close()
+
+		ptr := p.Get(10)
+		p.Put(ptr, 10)
+		p.Put(nil, 10)
+	})
+	t.Run("double_put", func(tt *testing.T) {
+		p := WithChecks(NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 64)))
+		defer p.Close()
+
+		ptr := p.Get(10)
+		p.Put(ptr, 10)
+		mustPanic(tt, "double put", func() { p.Put(ptr, 10) })
+	})
+	t.Run("foreign_put", func(tt *testing.T) {
+		inner := NewPool(DefaultMemoryAlignmentFunc)
+		defer inner.Close()
+
+		p := WithChecks(inner)
+		ptr := inner.Get(10)
+		defer inner.Put(ptr, 10)
+		mustPanic(tt, "foreign put", func() { p.Put(ptr, 10) })
+	})
+	t.Run("size_mismatch", func(tt *testing.T) {
+		p := WithChecks(NewPool(DefaultMemoryAlignmentFunc))
+		defer p.Close()
+
+		ptr := p.Get(10)
+		mustPanic(tt, "size mismatch", func() { p.Put(ptr, 20) })
+	})
+	t.Run("bridge", func(tt *testing.T) {
+		p := WithChecks(NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 64)))
+		defer p.Close()
+
+		h := CgoHandle(p)
+		defer h.Delete()
+		ctx := unsafe.Pointer(&h)
+
+		ptr, err := HandlePoolTryGet(ctx, 10)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if err := HandlePoolTryPut(ctx, ptr, 10); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+		err = HandlePoolTryPut(ctx, ptr, 10) // double put
+		if errors.Is(err, ErrPoolPanic) != true {
+			tt.Errorf("panic is returned as error: %+v", err)
+		}
+		if code := HandleErrorCode(err); code != HandleErrUnknown {
+			tt.Errorf("expect HandleErrUnknown actual=%d", code)
+		}
+		HandlePoolPutByValue(uintptr(h), ptr, 10) // must not panic
+	})
+}
+
+func TestWithStats(t *testing.T) {
+	p := WithStats(plainPool{NewPool(DefaultMemoryAlignmentFunc)})
+	defer p.Close()
+
+	ptr1 := p.Get(10)
+	ptr2 := p.Get(10)
+	p.Put(ptr1, 10)
+
+	st := p.Stats()
+	if st.Counters.Gets != 2 {
+		t.Errorf("expect 2 gets actual=%d", st.Counters.Gets)
+	}
+	if st.Counters.Puts != 1 {
+		t.Errorf("expect 1 put actual=%d", st.Counters.Puts)
+	}
+	if st.Outstanding.Count != 1 {
+		t.Errorf("expect 1 outstanding actual=%d", st.Outstanding.Count)
+	}
+	if st.Fallback.Size != int64(DefaultMemoryAlignmentFunc(10)) {
+		t.Errorf("other fields are forwarded actual=%d", st.Fallback.Size)
+	}
+	p.Put(ptr2, 10)
+}
+
+func TestWithLogging(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	inner := NewPool(DefaultMemoryAlignmentFunc)
+	p := WithLogging(inner, logger)
+	ptr := p.Get(10)
+	p.Put(ptr, 10)
+	p.Close()
+	p.Get(10)
+
+	out := buf.String()
+	for _, s := range []string{"cgobytepool: get", "cgobytepool: put", "cgobytepool: close", "cgobytepool: get failed", "size=10"} {
+		if strings.Contains(out, s) != true {
+			t.Errorf("log must contain %q: %s", s, out)
+		}
+	}
+}
+
+func TestDecoratorUnwrap(t *testing.T) {
+	inner := NewPool(DefaultMemoryAlignmentFunc)
+	defer inner.Close()
+
+	p := WithChecks(WithTracing(WithLimit(inner, 10)))
+	depth := 0
+	curr := Pool(p)
+	for {
+		next := Unwrap(curr)
+		if next == nil {
+			break
+		}
+		curr = next
+		depth += 1
+	}
+	if depth != 3 {
+		t.Errorf("expect depth=3 actual=%d", depth)
+	}
+	if curr.(*CgoBytePool) != inner {
+		t.Errorf("innermost must be inner pool")
+	}
+
+	ptr := p.Get(10)
+	if ptr == nil {
+		t.Errorf("stacked decorators must work")
+	}
+	p.Put(ptr, 10)
+}
@@ -0,0 +1,135 @@
+package cgobytepool
+
+import (
+	"math/rand"
+	"sync"
+	"unsafe"
+)
+
+var (
+	_ Allocator = (*FaultAllocator)(nil)
+)
+
+type FaultAllocatorOptionFunc func(*optFaultAllocator)
+
+type optFaultAllocator struct {
+	failNth      int64
+	failRate     float64
+	seed         int64
+	failAbove    int64
+	failAboveSet bool
+}
+
+// WithFailNth fails the nth (1-origin) call of Alloc.
+func WithFailNth(n int64) FaultAllocatorOptionFunc {
+	return func(opt *optFaultAllocator) {
+		opt.failNth = n
+	}
+}
+
+// WithFailProbability fails each Alloc with probability rate (0.0 - 1.0),
+// sequence of failures is deterministic for the same seed.
+func WithFailProbability(rate float64, seed int64) FaultAllocatorOptionFunc {
+	return func(opt *optFaultAllocator) {
+		opt.failRate = rate
+		opt.seed = seed
+	}
+}
+
+// WithFailAboveBytes fails Alloc that would make live allocated bytes exceed n.
+func WithFailAboveBytes(n int64) FaultAllocatorOptionFunc {
+	return func(opt *optFaultAllocator) {
+		opt.failAbove = n
+		opt.failAboveSet = true
+	}
+}
+
+// FaultAllocator wraps Allocator and makes Alloc return nil on configured conditions,
+// for testing out-of-memory paths of Go and C code.
+type FaultAllocator struct {
+	allocator Allocator
+	opt       *optFaultAllocator
+	mutex     *sync.Mutex
+	rand      *rand.Rand
+	calls     int64
+	failures  int64
+	bytes     int64
+}
+
+func (a *FaultAllocator) fail(size int) bool {
+	if 0 < a.opt.failNth && a.calls == a.opt.failNth {
+		return true
+	}
+	if 0 < a.opt.failRate && a.rand.Float64() < a.opt.failRate {
+		return true
+	}
+	if a.opt.failAboveSet && a.opt.failAbove < a.bytes+int64(size) {
+		return true
+	}
+	return false
+}
+
+func (a *FaultAllocator) Alloc(size int) unsafe.Pointer {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.calls += 1
+	if a.fail(size) {
+		a.failures += 1
+		return nil
+	}
+	ptr := a.allocator.Alloc(size)
+	if ptr != nil {
+		a.bytes += int64(size)
+	}
+	return ptr
+}
+
+func (a *FaultAllocator) Free(ptr unsafe.Pointer, size int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.bytes -= int64(size)
+	a.allocator.Free(ptr, size)
+}
+
+// Calls returns the number of Alloc calls.
+func (a *FaultAllocator) Calls() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.calls
+}
+
+// Failures returns the number of Alloc calls that returned nil by fault injection.
+func (a *FaultAllocator) Failures() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.failures
+}
+
+// AllocBytes returns live bytes allocated through this allocator.
+func (a *FaultAllocator) AllocBytes() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.bytes
+}
+
+// NewFaultAllocator wraps a, it uses libc malloc if a is nil.
+func NewFaultAllocator(a Allocator, funcs ...FaultAllocatorOptionFunc) *FaultAllocator {
+	if a == nil {
+		a = defaultAllocator
+	}
+	opt := new(optFaultAllocator)
+	for _, fn := range funcs {
+		fn(opt)
+	}
+	return &FaultAllocator{
+		allocator: a,
+		opt:       opt,
+		mutex:     new(sync.Mutex),
+		rand:      rand.New(rand.NewSource(opt.seed)),
+		calls:     0,
+		failures:  0,
+		bytes:     0,
+	}
+}
@@ -0,0 +1,115 @@
+package cgobytepool
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+func TestFaultAllocator(t *testing.T) {
+	t.Run("FailNth", func(tt *testing.T) {
+		a := NewFaultAllocator(nil, WithFailNth(2))
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100), WithAllocator(a))
+		defer p.Close()
+
+		ptr1 := p.Get(100)
+		if ptr1 == nil {
+			tt.Fatalf("1st alloc succeeds")
+		}
+		defer p.Put(ptr1, 100)
+
+		ptr2, err := p.TryGet(100)
+		if errors.Is(err, ErrAllocFailed) != true {
+			tt.Errorf("2nd alloc fails: %+v", err)
+		}
+		if ptr2 != nil {
+			tt.Errorf("nil on failure")
+		}
+		p.Put(ptr2, 100) // nil put is no-op
+		if p.TotalAllocBytes() != 352 {
+			tt.Errorf("failed alloc is not counted actual=%d", p.TotalAllocBytes())
+		}
+		if p.OutstandingCount() != 1 {
+			tt.Errorf("failed alloc is not outstanding actual=%d", p.OutstandingCount())
+		}
+
+		ptr3 := p.Get(100)
+		if ptr3 == nil {
+			tt.Errorf("3rd alloc succeeds")
+		}
+		defer p.Put(ptr3, 100)
+		if a.Calls() != 3 || a.Failures() != 1 {
+			tt.Errorf("calls=%d failures=%d", a.Calls(), a.Failures())
+		}
+	})
+	t.Run("FailProbability", func(tt *testing.T) {
+		run := func() []bool {
+			a := NewFaultAllocator(nil, WithFailProbability(0.5, 123))
+			results := make([]bool, 100)
+			for i := range results {
+				ptr := a.Alloc(100)
+				results[i] = ptr != nil
+				if ptr != nil {
+					a.Free(ptr, 100)
+				}
+			}
+			return results
+		}
+		r1, r2 := run(), run()
+		failures := 0
+		for i := range r1 {
+			if r1[i] != r2[i] {
+				tt.Errorf("deterministic for same seed: [%d]", i)
+			}
+			if r1[i] != true {
+				failures += 1
+			}
+		}
+		if failures == 0 || failures == 100 {
+			tt.Errorf("some fail actual=%d", failures)
+		}
+	})
+	t.Run("FailAboveBytes", func(tt *testing.T) {
+		a := NewFaultAllocator(nil, WithFailAboveBytes(1000))
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100), WithAllocator(a))
+		defer p.Close()
+
+		ptrs := make([]unsafe.Pointer, 0)
+		for {
+			ptr := p.Get(100)
+			if ptr == nil {
+				break
+			}
+			ptrs = append(ptrs, ptr)
+		}
+		if len(ptrs) != 2 {
+			tt.Errorf("352 * 2 <= 1000 actual=%d", len(ptrs))
+		}
+		if ptr := p.Get(500); ptr != nil {
+			tt.Errorf("fallback fails too")
+		}
+
+		p.Put(ptrs[0], 100)
+		p.Put(ptrs[1], 100)
+		p.Trim()
+		if a.AllocBytes() != 0 {
+			tt.Errorf("all freed actual=%d", a.AllocBytes())
+		}
+	})
+	t.Run("handle", func(tt *testing.T) {
+		a := NewFaultAllocator(nil, WithFailNth(1))
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100), WithAllocator(a))
+		defer p.Close()
+
+		h := CgoHandle(p)
+		defer h.Release()
+
+		ptr, err := HandlePoolTryGet(unsafe.Pointer(&h), 100)
+		if ptr != nil {
+			tt.Errorf("C receives NULL")
+		}
+		if HandleErrorCode(err) != HandleErrAllocFail {
+			tt.Errorf("actual=%d", HandleErrorCode(err))
+		}
+	})
+}
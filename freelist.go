@@ -0,0 +1,323 @@
+package cgobytepool
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+	_ "unsafe" // for go:linkname
+)
+
+// freelist holds idle buffers of a size class.
+type freelist interface {
+	push(unsafe.Pointer) bool // false if full
+	pop() (unsafe.Pointer, bool)
+	popCold() (unsafe.Pointer, bool) // least likely reused buffer, for trimming
+	len() int
+	cap() int
+}
+
+var (
+	_ freelist = (*chanFreelist)(nil)
+	_ freelist = (*stackFreelist)(nil)
+	_ freelist = (*shardedFreelist)(nil)
+)
+
+// chanFreelist reuses buffers in FIFO order.
+type chanFreelist struct {
+	ch chan unsafe.Pointer
+}
+
+func (f *chanFreelist) push(ptr unsafe.Pointer) bool {
+	select {
+	case f.ch <- ptr:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *chanFreelist) pop() (unsafe.Pointer, bool) {
+	select {
+	case ptr := <-f.ch:
+		return ptr, true
+	default:
+		return nil, false
+	}
+}
+
+// popCold is same as pop, the oldest buffer is the coldest.
+func (f *chanFreelist) popCold() (unsafe.Pointer, bool) {
+	return f.pop()
+}
+
+func (f *chanFreelist) len() int {
+	return len(f.ch)
+}
+
+func (f *chanFreelist) cap() int {
+	return cap(f.ch)
+}
+
+func newChanFreelist(size int) *chanFreelist {
+	return &chanFreelist{
+		ch: make(chan unsafe.Pointer, size),
+	}
+}
+
+// ptrStack is a fixed capacity stack on a ring buffer, so that both the top
+// and the bottom (least recently pushed) can be popped in O(1).
+type ptrStack struct {
+	buf    []unsafe.Pointer
+	bottom int
+	n      int
+}
+
+func (s *ptrStack) push(ptr unsafe.Pointer) bool {
+	if s.n == len(s.buf) {
+		return false
+	}
+	s.buf[(s.bottom+s.n)%len(s.buf)] = ptr
+	s.n += 1
+	return true
+}
+
+func (s *ptrStack) pop() (unsafe.Pointer, bool) {
+	if s.n == 0 {
+		return nil, false
+	}
+	i := (s.bottom + s.n - 1) % len(s.buf)
+	ptr := s.buf[i]
+	s.buf[i] = nil
+	s.n -= 1
+	return ptr, true
+}
+
+func (s *ptrStack) popBottom() (unsafe.Pointer, bool) {
+	if s.n == 0 {
+		return nil, false
+	}
+	ptr := s.buf[s.bottom]
+	s.buf[s.bottom] = nil
+	s.bottom = (s.bottom + 1) % len(s.buf)
+	s.n -= 1
+	return ptr, true
+}
+
+func newPtrStack(size int) ptrStack {
+	return ptrStack{
+		buf:    make([]unsafe.Pointer, size),
+		bottom: 0,
+		n:      0,
+	}
+}
+
+// stackFreelist reuses the most recently returned buffer first (LIFO),
+// which is likely still in CPU cache.
+type stackFreelist struct {
+	mutex *sync.Mutex
+	stack ptrStack
+}
+
+func (f *stackFreelist) push(ptr unsafe.Pointer) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.stack.push(ptr)
+}
+
+func (f *stackFreelist) pop() (unsafe.Pointer, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.stack.pop()
+}
+
+// popCold takes the bottom of stack, so that trimming keeps the cache-hot buffers.
+func (f *stackFreelist) popCold() (unsafe.Pointer, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.stack.popBottom()
+}
+
+func (f *stackFreelist) len() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.stack.n
+}
+
+func (f *stackFreelist) cap() int {
+	return len(f.stack.buf)
+}
+
+func newFreelist(kind freelistKind, size int) freelist {
+	switch kind {
+	case freelistLIFO:
+		return newStackFreelist(size)
+	case freelistSharded:
+		return newShardedFreelist(size)
+	}
+	return newChanFreelist(size)
+}
+
+func newStackFreelist(size int) *stackFreelist {
+	return &stackFreelist{
+		mutex: new(sync.Mutex),
+		stack: newPtrStack(size),
+	}
+}
+
+//go:linkname runtime_procPin runtime.procPin
+func runtime_procPin() int
+
+//go:linkname runtime_procUnpin runtime.procUnpin
+func runtime_procUnpin()
+
+// procID returns the id of P running the current goroutine, as sync.Pool selects its local pool.
+// The goroutine may migrate to other P right after return, then it just uses other shard.
+func procID() int {
+	id := runtime_procPin()
+	runtime_procUnpin()
+	return id
+}
+
+const (
+	maxShardLocalSize int = 64
+)
+
+type freelistShard struct {
+	mutex *sync.Mutex
+	stack ptrStack
+	_     [64]byte // avoid false sharing
+}
+
+func (s *freelistShard) push(ptr unsafe.Pointer) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stack.push(ptr)
+}
+
+func (s *freelistShard) pop() (unsafe.Pointer, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stack.pop()
+}
+
+func (s *freelistShard) popCold() (unsafe.Pointer, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stack.popBottom()
+}
+
+// shardedFreelist has a local cache per P and a shared depot, like sync.Pool,
+// but never drops buffers. Capacity of shards and depot sum up to size,
+// so idle buffers never exceed size.
+type shardedFreelist struct {
+	shards []freelistShard
+	mask   int
+	depot  *stackFreelist
+	count  int64
+	size   int
+}
+
+func (f *shardedFreelist) local() (*freelistShard, int) {
+	i := procID() & f.mask
+	return &f.shards[i], i
+}
+
+// push counts ptr before it is published, so that a concurrent pop never decrements first.
+func (f *shardedFreelist) push(ptr unsafe.Pointer) bool {
+	atomic.AddInt64(&f.count, 1)
+
+	s, i := f.local()
+	if s.push(ptr) || f.depot.push(ptr) {
+		return true
+	}
+	// local and depot are full, other shards may have room
+	for j := 1; j < len(f.shards); j += 1 {
+		if f.shards[(i+j)&f.mask].push(ptr) {
+			return true
+		}
+	}
+	atomic.AddInt64(&f.count, -1)
+	return false
+}
+
+func (f *shardedFreelist) pop() (unsafe.Pointer, bool) {
+	s, i := f.local()
+	if ptr, ok := s.pop(); ok {
+		atomic.AddInt64(&f.count, -1)
+		return ptr, true
+	}
+	if ptr, ok := f.depot.pop(); ok {
+		atomic.AddInt64(&f.count, -1)
+		return ptr, true
+	}
+	// steal from other shards
+	for j := 1; j < len(f.shards); j += 1 {
+		if ptr, ok := f.shards[(i+j)&f.mask].pop(); ok {
+			atomic.AddInt64(&f.count, -1)
+			return ptr, true
+		}
+	}
+	return nil, false
+}
+
+// popCold takes from depot first, it holds buffers overflowed from shards,
+// then the bottom of each shard.
+func (f *shardedFreelist) popCold() (unsafe.Pointer, bool) {
+	if ptr, ok := f.depot.popCold(); ok {
+		atomic.AddInt64(&f.count, -1)
+		return ptr, true
+	}
+	for i := range f.shards {
+		if ptr, ok := f.shards[i].popCold(); ok {
+			atomic.AddInt64(&f.count, -1)
+			return ptr, true
+		}
+	}
+	return nil, false
+}
+
+// count may exceed size while pushes to a full freelist are rolled back.
+func (f *shardedFreelist) len() int {
+	n := int(atomic.LoadInt64(&f.count))
+	if f.size < n {
+		return f.size
+	}
+	return n
+}
+
+func (f *shardedFreelist) cap() int {
+	return f.size
+}
+
+// newShardedFreelist creates shards of GOMAXPROCS rounded up to power of 2.
+func newShardedFreelist(size int) *shardedFreelist {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	localSize := size / (2 * n) // half of size is kept in depot
+	if maxShardLocalSize < localSize {
+		localSize = maxShardLocalSize
+	}
+
+	shards := make([]freelistShard, n)
+	for i := range shards {
+		shards[i].mutex = new(sync.Mutex)
+		shards[i].stack = newPtrStack(localSize)
+	}
+	return &shardedFreelist{
+		shards: shards,
+		mask:   n - 1,
+		depot:  newStackFreelist(size - n*localSize),
+		count:  0,
+		size:   size,
+	}
+}
@@ -0,0 +1,367 @@
+package cgobytepool
+
+import (
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+func TestFreelist(t *testing.T) {
+	bufs := make([]byte, 4)
+	ptrs := []unsafe.Pointer{
+		unsafe.Pointer(&bufs[0]),
+		unsafe.Pointer(&bufs[1]),
+		unsafe.Pointer(&bufs[2]),
+		unsafe.Pointer(&bufs[3]),
+	}
+
+	t.Run("fifo", func(tt *testing.T) {
+		testFreelistOrder(tt, newChanFreelist(3), ptrs, []int{0, 1, 2})
+	})
+	t.Run("lifo", func(tt *testing.T) {
+		testFreelistOrder(tt, newStackFreelist(3), ptrs, []int{2, 1, 0})
+	})
+	t.Run("pop_cold", func(tt *testing.T) {
+		for name, f := range map[string]freelist{
+			"fifo": newChanFreelist(3),
+			"lifo": newStackFreelist(3),
+		} {
+			for i := 0; i < 3; i += 1 {
+				f.push(ptrs[i])
+			}
+			if ptr, ok := f.popCold(); ok != true || ptr != ptrs[0] {
+				tt.Errorf("%s: least recently pushed is the coldest", name)
+			}
+			if f.len() != 2 {
+				tt.Errorf("%s: expect len=2 actual=%d", name, f.len())
+			}
+		}
+
+		// depot holds the buffers overflowed from shards, which pop takes last
+		f := newShardedFreelist(3)
+		for i := 0; i < 3; i += 1 {
+			f.push(ptrs[i])
+		}
+		cold := f.depot.stack.buf[f.depot.stack.bottom]
+		if ptr, ok := f.popCold(); ok != true || ptr != cold {
+			tt.Errorf("sharded: bottom of depot is the coldest")
+		}
+		if f.len() != 2 {
+			tt.Errorf("sharded: expect len=2 actual=%d", f.len())
+		}
+	})
+	t.Run("concurrent", func(tt *testing.T) {
+		for name, f := range map[string]freelist{
+			"fifo":    newChanFreelist(64),
+			"lifo":    newStackFreelist(64),
+			"sharded": newShardedFreelist(64),
+		} {
+			tt.Run(name, func(ttt *testing.T) {
+				testFreelistConcurrent(ttt, f)
+			})
+		}
+	})
+}
+
+func testFreelistOrder(t *testing.T, f freelist, ptrs []unsafe.Pointer, order []int) {
+	if f.cap() != 3 {
+		t.Errorf("expect cap=3 actual=%d", f.cap())
+	}
+	if _, ok := f.pop(); ok {
+		t.Errorf("empty freelist")
+	}
+	for i := 0; i < 3; i += 1 {
+		if f.push(ptrs[i]) != true {
+			t.Errorf("push[%d] must succeed", i)
+		}
+	}
+	if f.push(ptrs[3]) {
+		t.Errorf("full freelist must reject")
+	}
+	if f.len() != 3 {
+		t.Errorf("expect len=3 actual=%d", f.len())
+	}
+	for _, i := range order {
+		ptr, ok := f.pop()
+		if ok != true || ptr != ptrs[i] {
+			t.Errorf("expect ptrs[%d]", i)
+		}
+	}
+	if f.len() != 0 {
+		t.Errorf("expect len=0 actual=%d", f.len())
+	}
+}
+
+func testFreelistConcurrent(t *testing.T, f freelist) {
+	bufs := make([]byte, f.cap())
+	for i := range bufs {
+		f.push(unsafe.Pointer(&bufs[i]))
+	}
+
+	wg := new(sync.WaitGroup)
+	for g := 0; g < 8; g += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 1000; i += 1 {
+				if ptr, ok := f.pop(); ok {
+					f.push(ptr)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[unsafe.Pointer]bool)
+	for {
+		ptr, ok := f.pop()
+		if ok != true {
+			break
+		}
+		if seen[ptr] {
+			t.Errorf("duplicated %p", ptr)
+		}
+		seen[ptr] = true
+	}
+	if len(seen) != len(bufs) {
+		t.Errorf("expect %d buffers actual=%d", len(bufs), len(seen))
+	}
+}
+
+func TestPtrStack(t *testing.T) {
+	bufs := make([]byte, 8)
+	ptr := func(i int) unsafe.Pointer {
+		return unsafe.Pointer(&bufs[i])
+	}
+
+	s := newPtrStack(3)
+	s.push(ptr(0))
+	s.push(ptr(1))
+	s.push(ptr(2))
+	if s.push(ptr(3)) {
+		t.Errorf("full stack must reject")
+	}
+	// wrap around: bottom moves forward, top is written at the head of buf
+	if p, _ := s.popBottom(); p != ptr(0) {
+		t.Errorf("expect bottom ptr(0)")
+	}
+	s.push(ptr(3))
+	if p, _ := s.popBottom(); p != ptr(1) {
+		t.Errorf("expect bottom ptr(1)")
+	}
+	s.push(ptr(4))
+	for _, i := range []int{4, 3, 2} {
+		if p, ok := s.pop(); ok != true || p != ptr(i) {
+			t.Errorf("expect top ptr(%d)", i)
+		}
+	}
+	if _, ok := s.pop(); ok {
+		t.Errorf("empty stack")
+	}
+	if _, ok := s.popBottom(); ok {
+		t.Errorf("empty stack")
+	}
+
+	empty := newPtrStack(0)
+	if empty.push(ptr(0)) {
+		t.Errorf("zero capacity must reject")
+	}
+}
+
+func TestLIFOPoolSize(t *testing.T) {
+	t.Run("reuse_recent", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithLIFOPoolSize(10, 512))
+		defer p.Close()
+
+		ptr1 := p.Get(512)
+		ptr2 := p.Get(512)
+		p.Put(ptr1, 512)
+		p.Put(ptr2, 512)
+		if ptr := p.Get(512); ptr != ptr2 {
+			tt.Errorf("most recently returned buffer must be reused first")
+		} else {
+			p.Put(ptr, 512)
+		}
+	})
+	t.Run("trim_keeps_hot", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithLIFOPoolSize(10, 512))
+		defer p.Close()
+
+		ptrs := []unsafe.Pointer{p.Get(512), p.Get(512), p.Get(512)}
+		for _, ptr := range ptrs {
+			p.Put(ptr, 512)
+		}
+		bufSize := int64(p.pools[0].bufSize)
+		if freed := p.TrimTo(p.TotalAllocBytes() - (2 * bufSize)); freed != 2*bufSize {
+			tt.Errorf("expect freed=%d actual=%d", 2*bufSize, freed)
+		}
+		if ptr := p.Get(512); ptr != ptrs[2] {
+			tt.Errorf("most recently returned buffer survives trim")
+		} else {
+			p.Put(ptr, 512)
+		}
+	})
+	t.Run("fifo_default", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 512))
+		defer p.Close()
+
+		ptr1 := p.Get(512)
+		ptr2 := p.Get(512)
+		p.Put(ptr1, 512)
+		p.Put(ptr2, 512)
+		if ptr := p.Get(512); ptr != ptr1 {
+			tt.Errorf("oldest buffer is reused first")
+		} else {
+			p.Put(ptr, 512)
+		}
+	})
+	t.Run("mixed", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithLIFOPoolSize(2, 4096), WithPoolSize(2, 512))
+		defer p.Close()
+
+		if _, ok := p.pools[0].pool.(*chanFreelist); ok != true {
+			tt.Errorf("512 class is fifo")
+		}
+		if _, ok := p.pools[1].pool.(*stackFreelist); ok != true {
+			tt.Errorf("4096 class is lifo")
+		}
+
+		ptrs := []unsafe.Pointer{p.Get(4096), p.Get(4096), p.Get(4096)}
+		for _, ptr := range ptrs {
+			p.Put(ptr, 4096)
+		}
+		if p.pools[1].Len() != 2 {
+			tt.Errorf("capacity is kept actual=%d", p.pools[1].Len())
+		}
+		if st := p.Stats(); st.Counters.Frees != 1 {
+			tt.Errorf("overflow is freed actual=%d", st.Counters.Frees)
+		}
+	})
+}
+
+func TestShardedFreelist(t *testing.T) {
+	t.Run("exact_capacity", func(tt *testing.T) {
+		for _, size := range []int{0, 1, 3, 100, 1000} {
+			f := newShardedFreelist(size)
+			bufs := make([]byte, size+1)
+
+			wg := new(sync.WaitGroup)
+			pushed := make(chan bool, len(bufs))
+			for i := range bufs {
+				wg.Add(1)
+				go func(ptr unsafe.Pointer) {
+					defer wg.Done()
+					pushed <- f.push(ptr)
+				}(unsafe.Pointer(&bufs[i]))
+			}
+			wg.Wait()
+			close(pushed)
+
+			ok := 0
+			for p := range pushed {
+				if p {
+					ok += 1
+				}
+			}
+			if ok != size {
+				tt.Errorf("size=%d expect pushed=%d actual=%d", size, size, ok)
+			}
+			if f.len() != size {
+				tt.Errorf("size=%d expect len=%d actual=%d", size, size, f.len())
+			}
+			if f.cap() != size {
+				tt.Errorf("size=%d expect cap=%d actual=%d", size, size, f.cap())
+			}
+		}
+	})
+	t.Run("steal", func(tt *testing.T) {
+		f := newShardedFreelist(1000)
+		bufs := make([]byte, 1000)
+		n := 0
+		for i := range f.shards { // place buffers on every shard, regardless of current P
+			for f.shards[i].push(unsafe.Pointer(&bufs[n])) {
+				n += 1
+			}
+		}
+		f.count = int64(n)
+
+		for i := 0; i < n; i += 1 {
+			if _, ok := f.pop(); ok != true {
+				tt.Fatalf("pop[%d] must steal from other shards", i)
+			}
+		}
+		if f.len() != 0 {
+			tt.Errorf("expect len=0 actual=%d", f.len())
+		}
+	})
+}
+
+func TestShardedFreelistLen(t *testing.T) {
+	f := newShardedFreelist(16)
+	bufs := make([]byte, 32)
+
+	done := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	for g := 0; g < 8; g += 1 {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 10000; i += 1 {
+				ptr := unsafe.Pointer(&bufs[(g*4)+(i%4)])
+				f.push(ptr)
+				f.pop()
+			}
+		}(g)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if n := f.len(); n < 0 || f.cap() < n {
+			t.Fatalf("len must be in 0..%d actual=%d", f.cap(), n)
+		}
+	}
+}
+
+func TestShardedPoolSize(t *testing.T) {
+	p := NewPool(DefaultMemoryAlignmentFunc, WithShardedPoolSize(100, 512))
+	defer p.Close()
+
+	if _, ok := p.pools[0].pool.(*shardedFreelist); ok != true {
+		t.Errorf("512 class is sharded")
+	}
+
+	ptrs := make([]unsafe.Pointer, 150)
+	for i := range ptrs {
+		ptrs[i] = p.Get(512)
+	}
+	wg := new(sync.WaitGroup)
+	for i := range ptrs {
+		wg.Add(1)
+		go func(ptr unsafe.Pointer) {
+			defer wg.Done()
+			p.Put(ptr, 512)
+		}(ptrs[i])
+	}
+	wg.Wait()
+
+	if p.pools[0].Len() != 100 {
+		t.Errorf("capacity is kept actual=%d", p.pools[0].Len())
+	}
+	st := p.Stats()
+	if st.Counters.Mallocs != 150 {
+		t.Errorf("expect mallocs=150 actual=%d", st.Counters.Mallocs)
+	}
+	if st.Counters.Frees != 50 {
+		t.Errorf("overflow is freed actual=%d", st.Counters.Frees)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/octu0/cgobytepool
 
-go 1.19
+go 1.21
@@ -0,0 +1,160 @@
+package cgobytepool
+
+import (
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	defaultGovernorInterval time.Duration = 1 * time.Second
+)
+
+const (
+	metricsGoTotalBytes    string = "/memory/classes/total:bytes"
+	metricsGoReleasedBytes string = "/memory/classes/heap/released:bytes"
+)
+
+type MemoryGovernorStat struct {
+	GoLimit    int64 // value passed to debug.SetMemoryLimit
+	GoBytes    int64 // memory mapped by the Go runtime and not released to the OS
+	PoolBytes  int64 // TotalAllocBytes of CgoBytePool
+	PoolBudget int64 // MemoryBudget of CgoBytePool
+}
+
+type MemoryGovernorOptionFunc func(*optMemoryGovernor)
+
+type optMemoryGovernor struct {
+	interval   time.Duration
+	minGoLimit int64
+}
+
+func WithGovernorInterval(interval time.Duration) MemoryGovernorOptionFunc {
+	return func(opt *optMemoryGovernor) {
+		opt.interval = interval
+	}
+}
+
+// WithGovernorMinGoLimit sets the lower bound of the Go memory limit, so that
+// a large pool does not force the Go GC to run continuously.
+func WithGovernorMinGoLimit(n int64) MemoryGovernorOptionFunc {
+	return func(opt *optMemoryGovernor) {
+		opt.minGoLimit = n
+	}
+}
+
+// MemoryGovernor shares one process memory limit between the Go heap and CgoBytePool.
+// Memory held by the pool is subtracted from the Go memory limit, and the pool
+// freelists are trimmed when the Go memory grows into the pool share.
+// It can run with CgroupWatcher on the same pool, the tightest budget of both is used.
+type MemoryGovernor struct {
+	pool        *CgoBytePool
+	limit       int64
+	opt         *optMemoryGovernor
+	baseGoLimit int64
+	samples     []metrics.Sample
+	mutex       *sync.Mutex
+	once        *sync.Once
+	done        chan struct{}
+}
+
+func (g *MemoryGovernor) goBytes() int64 {
+	metrics.Read(g.samples)
+	total := g.samples[0].Value.Uint64()
+	released := g.samples[1].Value.Uint64()
+	return int64(total - released)
+}
+
+// Update recalculates the Go memory limit and the pool budget once.
+func (g *MemoryGovernor) Update() MemoryGovernorStat {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	goBytes := g.goBytes()
+
+	// give the pool what Go does not use
+	if g.limit < goBytes+g.pool.TotalAllocBytes() {
+		budget := g.limit - goBytes
+		if budget < 1 {
+			budget = 1 // 0 means unlimited
+		}
+		g.pool.setBudgetLimit(g, budget)
+	} else {
+		g.pool.clearBudgetLimit(g)
+	}
+	budget := g.pool.MemoryBudget()
+
+	poolBytes := g.pool.TotalAllocBytes()
+	goLimit := g.limit - poolBytes
+	if goLimit < g.opt.minGoLimit {
+		goLimit = g.opt.minGoLimit
+	}
+	debug.SetMemoryLimit(goLimit)
+
+	return MemoryGovernorStat{
+		GoLimit:    goLimit,
+		GoBytes:    goBytes,
+		PoolBytes:  poolBytes,
+		PoolBudget: budget,
+	}
+}
+
+func (g *MemoryGovernor) run() {
+	ticker := time.NewTicker(g.opt.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+			g.Update()
+		}
+	}
+}
+
+func (g *MemoryGovernor) Start() {
+	g.Update()
+	go g.run()
+}
+
+// Stop stops the governor, restores the Go memory limit it had before the governor was created
+// and removes the limit of the governor from the pool budget.
+func (g *MemoryGovernor) Stop() {
+	g.once.Do(func() {
+		close(g.done)
+
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+
+		debug.SetMemoryLimit(g.baseGoLimit)
+		g.pool.clearBudgetLimit(g)
+	})
+}
+
+// NewMemoryGovernor creates governor for the total memory limit of process.
+func NewMemoryGovernor(p *CgoBytePool, limit int64, funcs ...MemoryGovernorOptionFunc) *MemoryGovernor {
+	opt := &optMemoryGovernor{
+		interval:   defaultGovernorInterval,
+		minGoLimit: limit / 10,
+	}
+	for _, fn := range funcs {
+		fn(opt)
+	}
+
+	samples := []metrics.Sample{
+		{Name: metricsGoTotalBytes},
+		{Name: metricsGoReleasedBytes},
+	}
+	return &MemoryGovernor{
+		pool:        p,
+		limit:       limit,
+		opt:         opt,
+		baseGoLimit: debug.SetMemoryLimit(-1), // negative input does not adjust the limit
+		samples:     samples,
+		mutex:       new(sync.Mutex),
+		once:        new(sync.Once),
+		done:        make(chan struct{}),
+	}
+}
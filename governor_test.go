@@ -0,0 +1,103 @@
+package cgobytepool
+
+import (
+	"math"
+	"runtime/debug"
+	"testing"
+	"unsafe"
+)
+
+func TestMemoryGovernor(t *testing.T) {
+	t.Run("GoLimit", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 1024*1024))
+		defer p.Close()
+
+		ptr := p.Get(1024 * 1024)
+		defer p.Put(ptr, 1024*1024)
+
+		limit := int64(math.MaxInt64 / 2)
+		g := NewMemoryGovernor(p, limit)
+		stat := g.Update()
+		if stat.PoolBytes != p.TotalAllocBytes() {
+			tt.Errorf("actual=%d", stat.PoolBytes)
+		}
+		if stat.GoLimit != limit-p.TotalAllocBytes() {
+			tt.Errorf("go limit subtracts pool bytes actual=%d", stat.GoLimit)
+		}
+		if debug.SetMemoryLimit(-1) != stat.GoLimit {
+			tt.Errorf("go limit applied actual=%d", debug.SetMemoryLimit(-1))
+		}
+		if stat.PoolBudget != 0 {
+			tt.Errorf("enough memory, budget unlimited actual=%d", stat.PoolBudget)
+		}
+
+		g.Stop()
+		if debug.SetMemoryLimit(-1) != math.MaxInt64 {
+			tt.Errorf("go limit restored actual=%d", debug.SetMemoryLimit(-1))
+		}
+	})
+	t.Run("trim", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 1024*1024))
+		defer p.Close()
+
+		ptrs := make([]unsafe.Pointer, 4)
+		for i := 0; i < 4; i += 1 {
+			ptrs[i] = p.Get(1024 * 1024)
+		}
+		for i := 0; i < 4; i += 1 {
+			p.Put(ptrs[i], 1024*1024)
+		}
+		if p.TotalAllocBytes() == 0 {
+			tt.Fatalf("idle buffers must be retained")
+		}
+
+		// go memory already exceeds the limit
+		g := NewMemoryGovernor(p, 1024*1024, WithGovernorMinGoLimit(math.MaxInt64))
+		defer g.Stop()
+
+		stat := g.Update()
+		if stat.PoolBudget != 1 {
+			tt.Errorf("tightest budget actual=%d", stat.PoolBudget)
+		}
+		if p.TotalAllocBytes() != 0 {
+			tt.Errorf("idle buffers trimmed actual=%d", p.TotalAllocBytes())
+		}
+		if stat.GoLimit != math.MaxInt64 {
+			tt.Errorf("min go limit actual=%d", stat.GoLimit)
+		}
+	})
+	t.Run("with CgroupWatcher", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100), WithMemoryBudget(10000))
+		defer p.Close()
+
+		w, err := NewCgroupWatcher(p, WithCgroupPath("testdata/cgroup/stall"))
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if _, err := w.Check(); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if p.MemoryBudget() != 1 {
+			tt.Errorf("tightened by watcher actual=%d", p.MemoryBudget())
+		}
+
+		// enough memory for governor, it must not undo the limit of watcher
+		g := NewMemoryGovernor(p, math.MaxInt64/2)
+		if stat := g.Update(); stat.PoolBudget != 1 {
+			tt.Errorf("tightest budget is kept actual=%d", stat.PoolBudget)
+		}
+		g.Stop()
+		if p.MemoryBudget() != 1 {
+			tt.Errorf("watcher still limits after governor stopped actual=%d", p.MemoryBudget())
+		}
+
+		p.SetMemoryBudget(20000)
+		if p.MemoryBudget() != 1 {
+			tt.Errorf("base budget does not override limit actual=%d", p.MemoryBudget())
+		}
+		w.Stop()
+		if p.MemoryBudget() != 20000 {
+			tt.Errorf("base budget restored actual=%d", p.MemoryBudget())
+		}
+	})
+}
@@ -0,0 +1,402 @@
+package cgobytepool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+var (
+	ErrInvalidHandle = errors.New("cgobytepool: invalid handle")
+	ErrStaleHandle   = errors.New("cgobytepool: stale handle")
+	ErrForeignHandle = errors.New("cgobytepool: foreign handle")
+	ErrPoolPanic     = errors.New("cgobytepool: pool panicked")
+)
+
+// error codes returned to C
+const (
+	HandleOK            int = 0
+	HandleErrInvalid    int = -1
+	HandleErrStale      int = -2
+	HandleErrForeign    int = -3
+	HandleErrPoolClosed int = -4
+	HandleErrAllocFail  int = -5
+	HandleErrLimit      int = -6
+	HandleErrUnknown    int = -99
+)
+
+func HandleErrorCode(err error) int {
+	switch {
+	case err == nil:
+		return HandleOK
+	case errors.Is(err, ErrInvalidHandle):
+		return HandleErrInvalid
+	case errors.Is(err, ErrStaleHandle):
+		return HandleErrStale
+	case errors.Is(err, ErrForeignHandle):
+		return HandleErrForeign
+	case errors.Is(err, ErrPoolClosed):
+		return HandleErrPoolClosed
+	case errors.Is(err, ErrAllocFailed):
+		return HandleErrAllocFail
+	case errors.Is(err, ErrLimitExceeded):
+		return HandleErrLimit
+	}
+	return HandleErrUnknown
+}
+
+// Handle is passed to C instead of cgo.Handle.
+// It consists of tag, generation and slot index of the handle registry:
+//
+//	| tag(8bit) | generation | index |
+//
+// so that deleted (stale) handle never resolves to a pool registered later
+// in the same slot, and a value not issued by this package is detected as foreign.
+type Handle uintptr
+
+const (
+	uintptrBits     = 32 << (^uintptr(0) >> 63)
+	handleTagBits   = 8
+	handleIndexBits = uintptrBits / 2
+	handleGenBits   = uintptrBits - handleTagBits - handleIndexBits
+	handleTag       = uintptr(0xcb)
+	handleIndexMask = uintptr(1)<<handleIndexBits - 1
+	handleGenMask   = uintptr(1)<<handleGenBits - 1
+)
+
+func makeHandle(index, gen uintptr) Handle {
+	return Handle(handleTag<<(uintptrBits-handleTagBits) | (gen&handleGenMask)<<handleIndexBits | index&handleIndexMask)
+}
+
+func (h Handle) tag() uintptr {
+	return uintptr(h) >> (uintptrBits - handleTagBits)
+}
+
+func (h Handle) gen() uintptr {
+	return (uintptr(h) >> handleIndexBits) & handleGenMask
+}
+
+func (h Handle) index() uintptr {
+	return uintptr(h) & handleIndexMask
+}
+
+// Value returns the pool of h, or ErrInvalidHandle, ErrStaleHandle or ErrForeignHandle.
+func (h Handle) Value() (Pool, error) {
+	return defaultHandleRegistry.load(h)
+}
+
+// Retain adds a reference, each Retain must be paired with Release.
+func (h Handle) Retain() error {
+	return defaultHandleRegistry.retain(h)
+}
+
+// Release drops a reference, handle becomes stale when the last holder releases it.
+func (h Handle) Release() error {
+	return defaultHandleRegistry.release(h)
+}
+
+// Delete is same as Release, kept for compatibility with cgo.Handle.
+func (h Handle) Delete() {
+	h.Release()
+}
+
+// Released returns a channel that is closed when the last holder releases handle.
+func (h Handle) Released() <-chan struct{} {
+	return defaultHandleRegistry.released(h)
+}
+
+// handleEntry is immutable except refs, which is guarded by handleRegistry.mutex.
+type handleEntry struct {
+	gen      uintptr
+	refs     int64
+	pool     Pool
+	cgo      *CgoBytePool // non-nil if pool is *CgoBytePool, to skip interface dispatch
+	released chan struct{}
+}
+
+type handleSlot struct {
+	entry atomic.Pointer[handleEntry]
+	gen   uintptr // next generation, guarded by handleRegistry.mutex
+}
+
+const (
+	handleChunkBits = 8
+	handleChunkSize = 1 << handleChunkBits
+)
+
+type handleChunk [handleChunkSize]handleSlot
+
+// handleRegistry is a slot array specialized for lookups from the bridge functions:
+// lookups are lock-free indexed accesses, mutex is taken by store/retain/release only.
+type handleRegistry struct {
+	mutex  *sync.Mutex
+	chunks atomic.Pointer[[]*handleChunk]
+	size   uintptr
+	free   []uintptr
+}
+
+func (r *handleRegistry) slot(i uintptr) *handleSlot {
+	chunks := *r.chunks.Load()
+	c := i >> handleChunkBits
+	if uintptr(len(chunks)) <= c {
+		return nil
+	}
+	return &chunks[c][i&(handleChunkSize-1)]
+}
+
+func (r *handleRegistry) grow() {
+	chunks := *r.chunks.Load()
+	next := make([]*handleChunk, len(chunks)+1)
+	copy(next, chunks)
+	next[len(chunks)] = new(handleChunk)
+	r.chunks.Store(&next)
+}
+
+func (r *handleRegistry) store(p Pool) Handle {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i := uintptr(0)
+	if 0 < len(r.free) {
+		i = r.free[len(r.free)-1]
+		r.free = r.free[:len(r.free)-1]
+	} else {
+		i = r.size
+		if handleIndexMask < i {
+			panic("cgobytepool: too many handles")
+		}
+		if i&(handleChunkSize-1) == 0 {
+			r.grow()
+		}
+		r.size += 1
+	}
+
+	slot := r.slot(i)
+	if slot.gen == 0 {
+		slot.gen = 1
+	}
+	cp, _ := p.(*CgoBytePool)
+	slot.entry.Store(&handleEntry{
+		gen:      slot.gen,
+		refs:     1,
+		pool:     p,
+		cgo:      cp,
+		released: make(chan struct{}),
+	})
+	return makeHandle(i, slot.gen)
+}
+
+func (r *handleRegistry) lookup(h Handle) (*handleEntry, error) {
+	if h == 0 {
+		return nil, ErrInvalidHandle
+	}
+	if h.tag() != handleTag {
+		return nil, ErrForeignHandle
+	}
+	slot := r.slot(h.index())
+	if slot == nil {
+		return nil, ErrForeignHandle
+	}
+	e := slot.entry.Load()
+	if e == nil || e.gen != h.gen() {
+		return nil, ErrStaleHandle
+	}
+	return e, nil
+}
+
+func (r *handleRegistry) load(h Handle) (Pool, error) {
+	e, err := r.lookup(h)
+	if err != nil {
+		return nil, err
+	}
+	return e.pool, nil
+}
+
+func (r *handleRegistry) retain(h Handle) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	e, err := r.lookup(h)
+	if err != nil {
+		return err
+	}
+	e.refs += 1
+	return nil
+}
+
+func (r *handleRegistry) release(h Handle) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	e, err := r.lookup(h)
+	if err != nil {
+		return err
+	}
+	e.refs -= 1
+	if 0 < e.refs {
+		return nil
+	}
+
+	// last holder
+	slot := r.slot(h.index())
+	slot.entry.Store(nil)
+	slot.gen = (e.gen + 1) & handleGenMask
+	close(e.released)
+	r.free = append(r.free, h.index())
+	return nil
+}
+
+func (r *handleRegistry) released(h Handle) <-chan struct{} {
+	e, err := r.lookup(h)
+	if err != nil {
+		return closedChan // already released
+	}
+	return e.released
+}
+
+func newHandleRegistry() *handleRegistry {
+	r := &handleRegistry{
+		mutex: new(sync.Mutex),
+		size:  0,
+		free:  make([]uintptr, 0, 64),
+	}
+	chunks := make([]*handleChunk, 0)
+	r.chunks.Store(&chunks)
+	return r
+}
+
+var (
+	defaultHandleRegistry = newHandleRegistry()
+	closedChan            = func() chan struct{} {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}()
+)
+
+func handleFromContext(ctx unsafe.Pointer) Handle {
+	if ctx == nil {
+		return 0 // invalid
+	}
+	return *(*Handle)(ctx)
+}
+
+// recoverPoolPanic converts panic of Pool (e.g. WithChecks) into ErrPoolPanic,
+// a panic must not unwind across the C frame calling the bridge functions.
+func recoverPoolPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w: %v", ErrPoolPanic, r)
+	}
+}
+
+func handlePoolTryGet(h Handle, size int) (unsafe.Pointer, error) {
+	e, err := defaultHandleRegistry.lookup(h)
+	if err != nil {
+		return nil, err
+	}
+	if e.cgo != nil {
+		return e.cgo.TryGet(size) // fast path
+	}
+	return tryGetRecover(e.pool, size)
+}
+
+func tryGetRecover(p Pool, size int) (ptr unsafe.Pointer, err error) {
+	defer recoverPoolPanic(&err)
+
+	return poolTryGet(p, size)
+}
+
+func handlePoolTryPut(h Handle, data unsafe.Pointer, size int) error {
+	e, err := defaultHandleRegistry.lookup(h)
+	if err != nil {
+		return err
+	}
+	if e.cgo != nil {
+		e.cgo.Put(data, size) // fast path
+		return nil
+	}
+	return putRecover(e.pool, data, size)
+}
+
+func putRecover(p Pool, data unsafe.Pointer, size int) (err error) {
+	defer recoverPoolPanic(&err)
+
+	p.Put(data, size)
+	return nil
+}
+
+// HandlePoolGet returns buffer from pool of ctx, or nil if ctx is invalid.
+// ctx points to the Handle returned by CgoHandle.
+func HandlePoolGet(ctx unsafe.Pointer, size int) unsafe.Pointer {
+	ptr, _ := HandlePoolTryGet(ctx, size)
+	return ptr
+}
+
+func HandlePoolTryGet(ctx unsafe.Pointer, size int) (unsafe.Pointer, error) {
+	return handlePoolTryGet(handleFromContext(ctx), size)
+}
+
+func HandlePoolPut(ctx unsafe.Pointer, data unsafe.Pointer, size int) {
+	HandlePoolTryPut(ctx, data, size)
+}
+
+func HandlePoolTryPut(ctx unsafe.Pointer, data unsafe.Pointer, size int) error {
+	return handlePoolTryPut(handleFromContext(ctx), data, size)
+}
+
+// HandlePoolRetain adds a reference for another C consumer sharing ctx.
+func HandlePoolRetain(ctx unsafe.Pointer) error {
+	return defaultHandleRegistry.retain(handleFromContext(ctx))
+}
+
+// HandlePoolRelease drops a reference, the handle is deleted when the last holder releases it.
+func HandlePoolRelease(ctx unsafe.Pointer) error {
+	return defaultHandleRegistry.release(handleFromContext(ctx))
+}
+
+// HandlePoolFree is same as HandlePoolRelease.
+func HandlePoolFree(ctx unsafe.Pointer) {
+	HandlePoolRelease(ctx)
+}
+
+func HandlePoolTryFree(ctx unsafe.Pointer) error {
+	return HandlePoolRelease(ctx)
+}
+
+// CgoHandle returns reference counted handle of p, holding 1 reference.
+func CgoHandle(p Pool) Handle {
+	return defaultHandleRegistry.store(p)
+}
+
+// HandlePoolGetByValue is same as HandlePoolGet, but receives the Handle itself as uintptr_t.
+// Unlike a pointer to Go memory, C may keep the value in long-lived structs or other threads.
+func HandlePoolGetByValue(h uintptr, size int) unsafe.Pointer {
+	ptr, _ := handlePoolTryGet(Handle(h), size)
+	return ptr
+}
+
+func HandlePoolTryGetByValue(h uintptr, size int) (unsafe.Pointer, error) {
+	return handlePoolTryGet(Handle(h), size)
+}
+
+func HandlePoolPutByValue(h uintptr, data unsafe.Pointer, size int) {
+	handlePoolTryPut(Handle(h), data, size)
+}
+
+func HandlePoolTryPutByValue(h uintptr, data unsafe.Pointer, size int) error {
+	return handlePoolTryPut(Handle(h), data, size)
+}
+
+func HandlePoolRetainByValue(h uintptr) error {
+	return defaultHandleRegistry.retain(Handle(h))
+}
+
+func HandlePoolReleaseByValue(h uintptr) error {
+	return defaultHandleRegistry.release(Handle(h))
+}
+
+func HandlePoolFreeByValue(h uintptr) {
+	defaultHandleRegistry.release(Handle(h))
+}
@@ -0,0 +1,222 @@
+package cgobytepool
+
+import (
+	"errors"
+	"runtime/cgo"
+	"testing"
+	"unsafe"
+)
+
+func TestHandle(t *testing.T) {
+	t.Run("Get/Put", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 100))
+		defer p.Close()
+
+		h := CgoHandle(p)
+		ctx := unsafe.Pointer(&h)
+
+		ptr := HandlePoolGet(ctx, 100)
+		if ptr == nil {
+			tt.Fatalf("must alloc")
+		}
+		if p.TotalAllocBytes() != 352 {
+			tt.Errorf("actual=%d", p.TotalAllocBytes())
+		}
+		if err := HandlePoolTryPut(ctx, ptr, 100); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+		if p.Stats().Allocs[0].Len != 1 {
+			tt.Errorf("returned to pool")
+		}
+		if err := HandlePoolTryFree(ctx); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+	})
+	t.Run("stale", func(tt *testing.T) {
+		p1 := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 100))
+		defer p1.Close()
+		p2 := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 200))
+		defer p2.Close()
+
+		h1 := CgoHandle(p1)
+		ctx1 := unsafe.Pointer(&h1)
+		HandlePoolFree(ctx1)
+
+		// reuses slot of h1
+		h2 := CgoHandle(p2)
+		defer h2.Delete()
+		if h1.index() != h2.index() {
+			tt.Fatalf("slot reused h1=%x h2=%x", h1, h2)
+		}
+
+		ptr, err := HandlePoolTryGet(ctx1, 100)
+		if errors.Is(err, ErrStaleHandle) != true {
+			tt.Errorf("stale handle: %+v", err)
+		}
+		if ptr != nil {
+			tt.Errorf("stale handle returns nil")
+		}
+		if p2.TotalAllocBytes() != 0 {
+			tt.Errorf("stale handle must not resolve to p2 actual=%d", p2.TotalAllocBytes())
+		}
+		err = HandlePoolTryFree(ctx1)
+		if errors.Is(err, ErrStaleHandle) != true {
+			tt.Errorf("double free: %+v", err)
+		}
+		if HandleErrorCode(err) != HandleErrStale {
+			tt.Errorf("actual=%d", HandleErrorCode(err))
+		}
+
+		if _, err := h2.Value(); err != nil {
+			tt.Errorf("h2 is alive: %+v", err)
+		}
+	})
+	t.Run("foreign", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 100))
+		defer p.Close()
+
+		ch := cgo.NewHandle(p)
+		defer ch.Delete()
+
+		ptr, err := HandlePoolTryGet(unsafe.Pointer(&ch), 100)
+		if errors.Is(err, ErrForeignHandle) != true {
+			tt.Errorf("foreign handle: %+v", err)
+		}
+		if ptr != nil {
+			tt.Errorf("foreign handle returns nil")
+		}
+		if HandleErrorCode(err) != HandleErrForeign {
+			tt.Errorf("actual=%d", HandleErrorCode(err))
+		}
+
+		unknown := makeHandle(handleIndexMask, 1)
+		if _, err := unknown.Value(); errors.Is(err, ErrForeignHandle) != true {
+			tt.Errorf("out of range: %+v", err)
+		}
+	})
+	t.Run("invalid", func(tt *testing.T) {
+		if _, err := HandlePoolTryGet(nil, 100); errors.Is(err, ErrInvalidHandle) != true {
+			tt.Errorf("nil ctx: %+v", err)
+		}
+		h := Handle(0)
+		if err := HandlePoolTryPut(unsafe.Pointer(&h), nil, 100); errors.Is(err, ErrInvalidHandle) != true {
+			tt.Errorf("zero handle: %+v", err)
+		}
+	})
+	t.Run("closed", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 100))
+		h := CgoHandle(p)
+		defer h.Delete()
+
+		p.Close()
+		_, err := HandlePoolTryGet(unsafe.Pointer(&h), 100)
+		if HandleErrorCode(err) != HandleErrPoolClosed {
+			tt.Errorf("actual=%d", HandleErrorCode(err))
+		}
+	})
+	t.Run("refcount", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 100))
+		defer p.Close()
+
+		h := CgoHandle(p)
+		ctx := unsafe.Pointer(&h)
+
+		// 2 C consumers + Go
+		if err := HandlePoolRetain(ctx); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if err := HandlePoolRetain(ctx); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+
+		HandlePoolFree(ctx) // first C consumer finished
+		if _, err := HandlePoolTryGet(ctx, 100); err != nil {
+			tt.Errorf("other holders still use handle: %+v", err)
+		}
+		select {
+		case <-h.Released():
+			tt.Errorf("not released yet")
+		default:
+		}
+
+		if err := HandlePoolRelease(ctx); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+		if err := h.Release(); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+		select {
+		case <-h.Released():
+			// ok
+		default:
+			tt.Errorf("last holder released")
+		}
+
+		if _, err := h.Value(); errors.Is(err, ErrStaleHandle) != true {
+			tt.Errorf("deleted: %+v", err)
+		}
+		if err := h.Retain(); errors.Is(err, ErrStaleHandle) != true {
+			tt.Errorf("cannot retain released handle: %+v", err)
+		}
+	})
+	t.Run("ByValue", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 100))
+		defer p.Close()
+
+		h := uintptr(CgoHandle(p))
+
+		ptr := HandlePoolGetByValue(h, 100)
+		if ptr == nil {
+			tt.Fatalf("must alloc")
+		}
+		if err := HandlePoolTryPutByValue(h, ptr, 100); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+		if p.Stats().Allocs[0].Len != 1 {
+			tt.Errorf("returned to pool")
+		}
+
+		if err := HandlePoolRetainByValue(h); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+		HandlePoolFreeByValue(h)
+		if _, err := HandlePoolTryGetByValue(h, 100); err != nil {
+			tt.Errorf("1 reference remains: %+v", err)
+		}
+		if err := HandlePoolReleaseByValue(h); err != nil {
+			tt.Errorf("no error: %+v", err)
+		}
+		if HandlePoolGetByValue(h, 100) != nil {
+			tt.Errorf("released handle returns nil")
+		}
+		if _, err := HandlePoolTryGetByValue(12345, 100); errors.Is(err, ErrForeignHandle) != true {
+			tt.Errorf("foreign: %+v", err)
+		}
+	})
+	t.Run("many", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 100))
+		defer p.Close()
+
+		handles := make([]Handle, handleChunkSize*3+1)
+		for i := range handles {
+			handles[i] = CgoHandle(p)
+		}
+		for i, h := range handles {
+			v, err := h.Value()
+			if err != nil {
+				tt.Fatalf("handles[%d] no error: %+v", i, err)
+			}
+			if v.(*CgoBytePool) != p {
+				tt.Errorf("handles[%d] resolves to p", i)
+			}
+		}
+		for _, h := range handles {
+			h.Release()
+		}
+		for i, h := range handles {
+			if _, err := h.Value(); errors.Is(err, ErrStaleHandle) != true {
+				tt.Errorf("handles[%d] released: %+v", i, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,33 @@
+// Package putqueuetest enqueues buffers into cgobytepool.PutQueue from threads started by C.
+// It is only used by tests.
+package putqueuetest
+
+/*
+#cgo LDFLAGS: -lpthread
+#include <stdint.h>
+#include <stdlib.h>
+
+extern int cgobytepool_putqueuetest_enqueue_threads(void *q, uintptr_t handle, void **datas, size_t count, size_t size, int threads);
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/octu0/cgobytepool"
+)
+
+//export cgobytepool_putqueuetest_put
+func cgobytepool_putqueuetest_put(h C.uintptr_t, data unsafe.Pointer, size C.size_t) {
+	cgobytepool.HandlePoolPutByValue(uintptr(h), data, int(size))
+}
+
+// EnqueueThreads enqueues datas into q from threads started by C, full queue falls back to Put.
+// It returns the number of rejected enqueues, or -1 if a thread cannot be started.
+func EnqueueThreads(q *cgobytepool.PutQueue, h cgobytepool.Handle, datas []unsafe.Pointer, size, threads int) int {
+	cdatas := (*unsafe.Pointer)(C.malloc(C.size_t(unsafe.Sizeof(unsafe.Pointer(nil))) * C.size_t(len(datas))))
+	defer C.free(unsafe.Pointer(cdatas))
+	copy(unsafe.Slice(cdatas, len(datas)), datas)
+
+	return int(C.cgobytepool_putqueuetest_enqueue_threads(q.Pointer(), C.uintptr_t(h), cdatas, C.size_t(len(datas)), C.size_t(size), C.int(threads)))
+}
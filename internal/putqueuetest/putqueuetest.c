@@ -0,0 +1,56 @@
+#include <pthread.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+#include "../../cgobytepool.h"
+#include "_cgo_export.h"
+
+typedef struct cgobytepool_putqueuetest_producer_t {
+  cgobytepool_putq_t *q;
+  uintptr_t handle;
+  void **datas;
+  size_t count;
+  size_t size;
+  int rejected;
+} cgobytepool_putqueuetest_producer_t;
+
+static void *cgobytepool_putqueuetest_produce(void *arg) {
+  cgobytepool_putqueuetest_producer_t *p = (cgobytepool_putqueuetest_producer_t *) arg;
+  for (size_t i = 0; i < p->count; i += 1) {
+    if (cgobytepool_putq_enqueue(p->q, p->datas[i], p->size) != 0) {
+      cgobytepool_putqueuetest_put(p->handle, p->datas[i], p->size); // queue is full
+      p->rejected += 1;
+    }
+  }
+  return NULL;
+}
+
+// enqueues datas from threads started by C, each thread enqueues count/threads buffers.
+// started threads are joined before return even if pthread_create fails, they refer producers.
+int cgobytepool_putqueuetest_enqueue_threads(void *q, uintptr_t handle, void **datas, size_t count, size_t size, int threads) {
+  pthread_t tids[threads];
+  cgobytepool_putqueuetest_producer_t producers[threads];
+  size_t per = count / threads;
+  int started = 0;
+  for (int i = 0; i < threads; i += 1) {
+    producers[i].q = (cgobytepool_putq_t *) q;
+    producers[i].handle = handle;
+    producers[i].datas = datas + (per * i);
+    producers[i].count = (i == threads - 1) ? count - (per * i) : per;
+    producers[i].size = size;
+    producers[i].rejected = 0;
+    if (pthread_create(&tids[i], NULL, cgobytepool_putqueuetest_produce, &producers[i]) != 0) {
+      break;
+    }
+    started += 1;
+  }
+  int rejected = 0;
+  for (int i = 0; i < started; i += 1) {
+    pthread_join(tids[i], NULL);
+    rejected += producers[i].rejected;
+  }
+  if (started < threads) {
+    return -1;
+  }
+  return rejected;
+}
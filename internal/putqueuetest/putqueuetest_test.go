@@ -0,0 +1,50 @@
+package putqueuetest
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/octu0/cgobytepool"
+)
+
+func TestEnqueueThreads(t *testing.T) {
+	p := cgobytepool.NewPool(
+		cgobytepool.DefaultMemoryAlignmentFunc,
+		cgobytepool.WithPoolSize(8000, 512),
+	)
+	defer p.Close()
+
+	h := cgobytepool.CgoHandle(p)
+	defer h.Release()
+
+	q, err := cgobytepool.NewPutQueue(p, 256)
+	if err != nil {
+		t.Fatalf("no error: %+v", err)
+	}
+	q.Start(100 * time.Microsecond)
+
+	datas := make([]unsafe.Pointer, 8000)
+	for i := range datas {
+		datas[i] = p.Get(512)
+	}
+	rejected := EnqueueThreads(q, h, datas, 512, 8)
+	if rejected < 0 {
+		t.Fatalf("pthread_create failed")
+	}
+	q.Close()
+
+	if p.OutstandingCount() != 0 {
+		t.Errorf("all returned actual=%d", p.OutstandingCount())
+	}
+	st := q.Stats()
+	if st.Drained+int64(rejected) != int64(len(datas)) {
+		t.Errorf("drained=%d rejected=%d", st.Drained, rejected)
+	}
+	if st.Rejected != int64(rejected) {
+		t.Errorf("rejected counted by queue=%d actual=%d", st.Rejected, rejected)
+	}
+	if p.Stats().Allocs[0].Len != len(datas) {
+		t.Errorf("distinct buffers returned actual=%d", p.Stats().Allocs[0].Len)
+	}
+}
@@ -0,0 +1,93 @@
+package cgobytepool
+
+import (
+	"unsafe"
+)
+
+// FallbackClass is the class id of buffers allocated outside of size classes.
+const FallbackClass int = -1
+
+// Observer receives pool events. class is the size class id (same as PoolStats.Allocs ID,
+// FallbackClass for fallback), size is the requested size for OnGet/OnPut and
+// the allocated size for the others.
+// Methods are called synchronously from the goroutine (or C thread) using the pool,
+// so they must be safe for concurrent use and should return quickly.
+type Observer interface {
+	OnGet(class int, size int, ptr unsafe.Pointer)
+	OnPut(class int, size int, ptr unsafe.Pointer)
+	OnMalloc(class int, size int, ptr unsafe.Pointer)
+	OnFree(class int, size int, ptr unsafe.Pointer)
+	OnFallback(class int, size int, ptr unsafe.Pointer) // Get larger than any size class
+	OnOverflow(class int, size int, ptr unsafe.Pointer) // Put to full freelist, followed by OnFree
+	OnClose()
+}
+
+var (
+	_ Observer = NopObserver{}
+	_ Observer = (multiObserver)(nil)
+)
+
+// NopObserver can be embedded to implement only some of the Observer methods.
+type NopObserver struct{}
+
+func (NopObserver) OnGet(int, int, unsafe.Pointer)      {}
+func (NopObserver) OnPut(int, int, unsafe.Pointer)      {}
+func (NopObserver) OnMalloc(int, int, unsafe.Pointer)   {}
+func (NopObserver) OnFree(int, int, unsafe.Pointer)     {}
+func (NopObserver) OnFallback(int, int, unsafe.Pointer) {}
+func (NopObserver) OnOverflow(int, int, unsafe.Pointer) {}
+func (NopObserver) OnClose()                            {}
+
+type multiObserver []Observer
+
+func (m multiObserver) OnGet(class int, size int, ptr unsafe.Pointer) {
+	for _, o := range m {
+		o.OnGet(class, size, ptr)
+	}
+}
+
+func (m multiObserver) OnPut(class int, size int, ptr unsafe.Pointer) {
+	for _, o := range m {
+		o.OnPut(class, size, ptr)
+	}
+}
+
+func (m multiObserver) OnMalloc(class int, size int, ptr unsafe.Pointer) {
+	for _, o := range m {
+		o.OnMalloc(class, size, ptr)
+	}
+}
+
+func (m multiObserver) OnFree(class int, size int, ptr unsafe.Pointer) {
+	for _, o := range m {
+		o.OnFree(class, size, ptr)
+	}
+}
+
+func (m multiObserver) OnFallback(class int, size int, ptr unsafe.Pointer) {
+	for _, o := range m {
+		o.OnFallback(class, size, ptr)
+	}
+}
+
+func (m multiObserver) OnOverflow(class int, size int, ptr unsafe.Pointer) {
+	for _, o := range m {
+		o.OnOverflow(class, size, ptr)
+	}
+}
+
+func (m multiObserver) OnClose() {
+	for _, o := range m {
+		o.OnClose()
+	}
+}
+
+func newObserver(observers []Observer) Observer {
+	switch len(observers) {
+	case 0:
+		return nil
+	case 1:
+		return observers[0]
+	}
+	return multiObserver(observers)
+}
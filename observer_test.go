@@ -0,0 +1,122 @@
+package cgobytepool
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+type testObserver struct {
+	mutex  *sync.Mutex
+	events []string
+}
+
+func (o *testObserver) add(name string, class, size int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.events = append(o.events, fmt.Sprintf("%s(%d,%d)", name, class, size))
+}
+
+func (o *testObserver) OnGet(class, size int, ptr unsafe.Pointer)    { o.add("Get", class, size) }
+func (o *testObserver) OnPut(class, size int, ptr unsafe.Pointer)    { o.add("Put", class, size) }
+func (o *testObserver) OnMalloc(class, size int, ptr unsafe.Pointer) { o.add("Malloc", class, size) }
+func (o *testObserver) OnFree(class, size int, ptr unsafe.Pointer)   { o.add("Free", class, size) }
+func (o *testObserver) OnFallback(class, size int, ptr unsafe.Pointer) {
+	o.add("Fallback", class, size)
+}
+func (o *testObserver) OnOverflow(class, size int, ptr unsafe.Pointer) {
+	o.add("Overflow", class, size)
+}
+func (o *testObserver) OnClose() { o.add("Close", 0, 0) }
+
+func newTestObserver() *testObserver {
+	return &testObserver{
+		mutex:  new(sync.Mutex),
+		events: make([]string, 0),
+	}
+}
+
+type getCounter struct {
+	NopObserver
+	gets int
+}
+
+func (c *getCounter) OnGet(class, size int, ptr unsafe.Pointer) {
+	c.gets += 1
+}
+
+func TestObserver(t *testing.T) {
+	t.Run("events", func(tt *testing.T) {
+		o := newTestObserver()
+		p := NewPool(func(n int) int { return n }, WithPoolSize(1, 128), WithPoolSize(1, 64), WithObserver(o))
+
+		ptr1 := p.Get(60)
+		ptr2 := p.Get(60)
+		ptr3 := p.Get(100)
+		ptr4 := p.Get(1000)
+		p.Put(ptr1, 60)
+		p.Put(ptr2, 60)
+		p.Put(ptr3, 100)
+		p.Put(ptr4, 1000)
+		p.Close()
+
+		expect := []string{
+			"Malloc(0,64)", "Get(0,60)",
+			"Malloc(0,64)", "Get(0,60)",
+			"Malloc(1,128)", "Get(1,100)",
+			"Fallback(-1,1000)", "Malloc(-1,1000)", "Get(-1,1000)",
+			"Put(0,60)",
+			"Put(0,60)", "Overflow(0,64)", "Free(0,64)",
+			"Put(1,100)",
+			"Put(-1,1000)", "Free(-1,1000)",
+			"Free(0,64)", "Free(1,128)", "Close(0,0)",
+		}
+		if len(o.events) != len(expect) {
+			tt.Fatalf("expect %v actual=%v", expect, o.events)
+		}
+		for i := range expect {
+			if o.events[i] != expect[i] {
+				tt.Errorf("events[%d] expect %s actual=%s", i, expect[i], o.events[i])
+			}
+		}
+	})
+	t.Run("class_id_matches_stats", func(tt *testing.T) {
+		o := newTestObserver()
+		p := NewPool(func(n int) int { return n }, WithPoolSize(1, 64), WithPoolSize(1, 128), WithObserver(o))
+		defer p.Close()
+
+		ptr := p.Get(100)
+		p.Put(ptr, 100)
+		if p.Stats().Allocs[1].Size != 128 {
+			tt.Errorf("class 1 is 128 bytes")
+		}
+		if o.events[1] != "Get(1,100)" {
+			tt.Errorf("128 bytes class expect id=1 actual=%s", o.events[1])
+		}
+	})
+	t.Run("multiple", func(tt *testing.T) {
+		c1, c2 := new(getCounter), new(getCounter)
+		p := NewPool(DefaultMemoryAlignmentFunc, WithObserver(c1), WithObserver(c2))
+		defer p.Close()
+
+		ptr := p.Get(10)
+		p.Put(ptr, 10)
+		if c1.gets != 1 || c2.gets != 1 {
+			tt.Errorf("all observers notified c1=%d c2=%d", c1.gets, c2.gets)
+		}
+	})
+	t.Run("trim", func(tt *testing.T) {
+		o := newTestObserver()
+		p := NewPool(func(n int) int { return n }, WithPoolSize(4, 64), WithObserver(o))
+		defer p.Close()
+
+		ptr := p.Get(64)
+		p.Put(ptr, 64)
+		o.events = o.events[:0]
+		p.Trim()
+		if len(o.events) != 1 || o.events[0] != "Free(0,64)" {
+			tt.Errorf("trim notifies free actual=%v", o.events)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package pooltest
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+extern int cgobytepool_pooltest_roundtrip(uintptr_t handle, size_t size, unsigned char value);
+extern unsigned char *cgobytepool_pooltest_fill(uintptr_t handle, size_t size, unsigned char value);
+extern void cgobytepool_pooltest_release(uintptr_t handle, unsigned char *data, size_t size);
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/octu0/cgobytepool"
+)
+
+//export cgobytepool_pooltest_get
+func cgobytepool_pooltest_get(h C.uintptr_t, size C.size_t) unsafe.Pointer {
+	return cgobytepool.HandlePoolGetByValue(uintptr(h), int(size))
+}
+
+//export cgobytepool_pooltest_put
+func cgobytepool_pooltest_put(h C.uintptr_t, data unsafe.Pointer, size C.size_t) {
+	cgobytepool.HandlePoolPutByValue(uintptr(h), data, int(size))
+}
+
+func cRoundTrip(h cgobytepool.Handle, size int, value byte) int {
+	return int(C.cgobytepool_pooltest_roundtrip(C.uintptr_t(h), C.size_t(size), C.uchar(value)))
+}
+
+func cFill(h cgobytepool.Handle, size int, value byte) unsafe.Pointer {
+	return unsafe.Pointer(C.cgobytepool_pooltest_fill(C.uintptr_t(h), C.size_t(size), C.uchar(value)))
+}
+
+func cRelease(h cgobytepool.Handle, data unsafe.Pointer, size int) {
+	C.cgobytepool_pooltest_release(C.uintptr_t(h), (*C.uchar)(data), C.size_t(size))
+}
@@ -0,0 +1,33 @@
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "_cgo_export.h"
+
+int cgobytepool_pooltest_roundtrip(uintptr_t handle, size_t size, unsigned char value) {
+  unsigned char *data = (unsigned char *) cgobytepool_pooltest_get(handle, size);
+  if (data == NULL) {
+    return -1;
+  }
+  memset(data, value, size);
+  for (size_t i = 0; i < size; i += 1) {
+    if (data[i] != value) {
+      cgobytepool_pooltest_put(handle, data, size);
+      return -2;
+    }
+  }
+  cgobytepool_pooltest_put(handle, data, size);
+  return 0;
+}
+
+unsigned char *cgobytepool_pooltest_fill(uintptr_t handle, size_t size, unsigned char value) {
+  unsigned char *data = (unsigned char *) cgobytepool_pooltest_get(handle, size);
+  if (data != NULL) {
+    memset(data, value, size);
+  }
+  return data;
+}
+
+void cgobytepool_pooltest_release(uintptr_t handle, unsigned char *data, size_t size) {
+  cgobytepool_pooltest_put(handle, data, size);
+}
@@ -0,0 +1,270 @@
+// Package pooltest provides conformance tests for cgobytepool.Pool implementations.
+//
+//	func TestMyPool(t *testing.T) {
+//		pooltest.Run(t, func() cgobytepool.Pool {
+//			return NewMyPool()
+//		})
+//	}
+//
+// Run the tests with -race to detect data races of concurrent use.
+package pooltest
+
+import (
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/octu0/cgobytepool"
+)
+
+var (
+	sizes           = []int{1, 7, 64, 100, 255, 256, 257, 512, 4095, 4096, 4097, 16 * 1024, 1024 * 1024}
+	concurrentSizes = []int{1, 64, 100, 512, 4096, 16 * 1024}
+)
+
+// Run runs the conformance suite, newPool is called for each sub test.
+func Run(t *testing.T, newPool func() cgobytepool.Pool) {
+	t.Run("GetPut", func(tt *testing.T) {
+		testGetPut(tt, newPool())
+	})
+	t.Run("Distinct", func(tt *testing.T) {
+		testDistinct(tt, newPool())
+	})
+	t.Run("SizeBoundary", func(tt *testing.T) {
+		testSizeBoundary(tt, newPool())
+	})
+	t.Run("Concurrent", func(tt *testing.T) {
+		testConcurrent(tt, newPool())
+	})
+	t.Run("Stats", func(tt *testing.T) {
+		testStats(tt, newPool())
+	})
+	t.Run("Close", func(tt *testing.T) {
+		testClose(tt, newPool())
+	})
+	t.Run("Handle", func(tt *testing.T) {
+		testHandle(tt, newPool())
+	})
+}
+
+func fill(ptr unsafe.Pointer, size int, value byte) {
+	data := unsafe.Slice((*byte)(ptr), size)
+	for i := range data {
+		data[i] = value
+	}
+}
+
+func verify(ptr unsafe.Pointer, size int, value byte) bool {
+	data := unsafe.Slice((*byte)(ptr), size)
+	for i := range data {
+		if data[i] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func testGetPut(t *testing.T, p cgobytepool.Pool) {
+	defer p.Close()
+
+	for _, size := range sizes {
+		ptr := p.Get(size)
+		if ptr == nil {
+			t.Fatalf("Get(%d) returns nil", size)
+		}
+		fill(ptr, size, 0xab)
+		if verify(ptr, size, 0xab) != true {
+			t.Errorf("Get(%d) buffer is not writable", size)
+		}
+		p.Put(ptr, size)
+
+		// round trip twice, buffer may be reused
+		ptr = p.Get(size)
+		if ptr == nil {
+			t.Fatalf("Get(%d) after Put returns nil", size)
+		}
+		fill(ptr, size, 0xcd)
+		p.Put(ptr, size)
+	}
+}
+
+func testDistinct(t *testing.T, p cgobytepool.Pool) {
+	defer p.Close()
+
+	size := 64
+	ptrs := make([]unsafe.Pointer, 200)
+	for i := range ptrs {
+		ptrs[i] = p.Get(size)
+		if ptrs[i] == nil {
+			t.Fatalf("Get(%d) returns nil", size)
+		}
+		fill(ptrs[i], size, byte(i))
+	}
+	for i := range ptrs {
+		if verify(ptrs[i], size, byte(i)) != true {
+			t.Errorf("outstanding buffers[%d] overlaps with another buffer", i)
+		}
+	}
+	for i := range ptrs {
+		p.Put(ptrs[i], size)
+	}
+}
+
+func testSizeBoundary(t *testing.T, p cgobytepool.Pool) {
+	defer p.Close()
+
+	// zero size must not crash
+	if ptr := p.Get(0); ptr != nil {
+		p.Put(ptr, 0)
+	}
+
+	for shift := 3; shift <= 20; shift += 1 {
+		for _, size := range []int{(1 << shift) - 1, 1 << shift, (1 << shift) + 1} {
+			ptr := p.Get(size)
+			if ptr == nil {
+				t.Fatalf("Get(%d) returns nil", size)
+			}
+			fill(ptr, size, byte(shift))
+			p.Put(ptr, size)
+		}
+	}
+}
+
+func testConcurrent(t *testing.T, p cgobytepool.Pool) {
+	defer p.Close()
+
+	wg := new(sync.WaitGroup)
+	errs := make(chan int, 16)
+	for g := 0; g < 16; g += 1 {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 200; i += 1 {
+				size := concurrentSizes[(g+i)%len(concurrentSizes)]
+				ptr := p.Get(size)
+				if ptr == nil {
+					errs <- size
+					return
+				}
+				fill(ptr, size, byte(g))
+				if verify(ptr, size, byte(g)) != true {
+					errs <- size
+					return
+				}
+				p.Put(ptr, size)
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+
+	for size := range errs {
+		t.Errorf("concurrent Get(%d) returns nil or shared buffer", size)
+	}
+}
+
+func testStats(t *testing.T, p cgobytepool.Pool) {
+	defer p.Close()
+
+	ptrs := make([]unsafe.Pointer, len(sizes))
+	for i, size := range sizes {
+		ptrs[i] = p.Get(size)
+		if ptrs[i] == nil {
+			t.Fatalf("Get(%d) returns nil", size)
+		}
+	}
+
+	stats := p.Stats()
+	ids := make(map[int]bool, len(stats.Allocs))
+	for _, a := range stats.Allocs {
+		if ids[a.ID] {
+			t.Errorf("Allocs ID %d duplicated", a.ID)
+		}
+		ids[a.ID] = true
+		if a.Size < 0 {
+			t.Errorf("Allocs[%d].Size negative: %d", a.ID, a.Size)
+		}
+		if a.Len < 0 || a.Cap < a.Len {
+			t.Errorf("Allocs[%d] Len=%d Cap=%d", a.ID, a.Len, a.Cap)
+		}
+	}
+	if stats.Fallback.Size < 0 {
+		t.Errorf("Fallback.Size negative: %d", stats.Fallback.Size)
+	}
+	if stats.Outstanding.Count != 0 && stats.Outstanding.Count != int64(len(sizes)) {
+		t.Errorf("Outstanding.Count must be 0 (not supported) or %d actual=%d", len(sizes), stats.Outstanding.Count)
+	}
+	if stats.Outstanding.Count < stats.Outstanding.Fallbacks {
+		t.Errorf("Outstanding.Fallbacks=%d > Count=%d", stats.Outstanding.Fallbacks, stats.Outstanding.Count)
+	}
+	if stats.Closed {
+		t.Errorf("not closed yet")
+	}
+
+	for i, size := range sizes {
+		p.Put(ptrs[i], size)
+	}
+	if n := p.Stats().Outstanding.Count; n != 0 {
+		t.Errorf("all buffers returned, Outstanding.Count=%d", n)
+	}
+}
+
+func testClose(t *testing.T, p cgobytepool.Pool) {
+	ptr1 := p.Get(100)
+	ptr2 := p.Get(1024 * 1024)
+	if ptr1 == nil || ptr2 == nil {
+		t.Fatalf("Get returns nil")
+	}
+	idle := p.Get(100)
+	p.Put(idle, 100)
+
+	p.Close()
+	p.Close() // twice must not panic
+
+	// outstanding buffers stay usable until Put
+	fill(ptr1, 100, 1)
+	fill(ptr2, 1024*1024, 2)
+
+	// late Put must not panic
+	p.Put(ptr1, 100)
+	p.Put(ptr2, 1024*1024)
+
+	// Get after Close must not panic, either nil or usable buffer
+	if ptr := p.Get(100); ptr != nil {
+		fill(ptr, 100, 3)
+		p.Put(ptr, 100)
+	}
+	p.Stats()
+}
+
+func testHandle(t *testing.T, p cgobytepool.Pool) {
+	defer p.Close()
+
+	h := cgobytepool.CgoHandle(p)
+	defer h.Release()
+
+	for _, size := range sizes {
+		if ret := cRoundTrip(h, size, 0x5a); ret != 0 {
+			t.Errorf("C roundtrip size=%d ret=%d", size, ret)
+		}
+	}
+
+	// buffer written by C is visible from Go and can be returned from Go
+	ptr := cFill(h, 4096, 0x7e)
+	if ptr == nil {
+		t.Fatalf("C Get returns NULL")
+	}
+	if verify(ptr, 4096, 0x7e) != true {
+		t.Errorf("data written by C is not visible in Go")
+	}
+	p.Put(ptr, 4096)
+
+	// buffer from Go can be returned from C
+	ptr = p.Get(4096)
+	if ptr == nil {
+		t.Fatalf("Get(%d) returns nil", 4096)
+	}
+	fill(ptr, 4096, 0x11)
+	cRelease(h, ptr, 4096)
+}
@@ -0,0 +1,129 @@
+package pooltest
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/octu0/cgobytepool"
+)
+
+type wrapPool struct {
+	cgobytepool.Pool
+}
+
+func TestRun(t *testing.T) {
+	t.Run("CgoBytePool", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.NewPool(
+				cgobytepool.DefaultMemoryAlignmentFunc,
+				cgobytepool.WithPoolSize(100, 16*1024),
+				cgobytepool.WithPoolSize(100, 4*1024),
+				cgobytepool.WithPoolSize(100, 512),
+			)
+		})
+	})
+	t.Run("NoSizeClass", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.NewPool(cgobytepool.DefaultMemoryAlignmentFunc)
+		})
+	})
+	t.Run("GoAllocator", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.NewPool(
+				cgobytepool.DefaultMemoryAlignmentFunc,
+				cgobytepool.WithPoolSize(100, 512),
+				cgobytepool.WithAllocator(cgobytepool.NewGoAllocator()),
+			)
+		})
+	})
+	t.Run("LIFO", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.NewPool(
+				cgobytepool.DefaultMemoryAlignmentFunc,
+				cgobytepool.WithLIFOPoolSize(100, 16*1024),
+				cgobytepool.WithLIFOPoolSize(100, 512),
+			)
+		})
+	})
+	t.Run("Sharded", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.NewPool(
+				cgobytepool.DefaultMemoryAlignmentFunc,
+				cgobytepool.WithShardedPoolSize(100, 16*1024),
+				cgobytepool.WithShardedPoolSize(100, 512),
+			)
+		})
+	})
+	t.Run("wrapped", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return wrapPool{cgobytepool.NewPool(
+				cgobytepool.DefaultMemoryAlignmentFunc,
+				cgobytepool.WithPoolSize(100, 512),
+			)}
+		})
+	})
+}
+
+func TestRunDecorators(t *testing.T) {
+	newPool := func() cgobytepool.Pool {
+		return cgobytepool.NewPool(
+			cgobytepool.DefaultMemoryAlignmentFunc,
+			cgobytepool.WithPoolSize(100, 4*1024),
+			cgobytepool.WithPoolSize(100, 512),
+		)
+	}
+	t.Run("Limit", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.WithLimit(newPool(), 1000)
+		})
+	})
+	t.Run("Tracing", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.WithTracing(newPool())
+		})
+	})
+	t.Run("Checks", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.WithChecks(newPool())
+		})
+	})
+	t.Run("Stats", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.WithStats(wrapPool{newPool()})
+		})
+	})
+	t.Run("Logging", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.WithLogging(newPool(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+		})
+	})
+	t.Run("Stacked", func(tt *testing.T) {
+		Run(tt, func() cgobytepool.Pool {
+			return cgobytepool.WithChecks(cgobytepool.WithStats(cgobytepool.WithLimit(cgobytepool.WithTracing(newPool()), 1000)))
+		})
+	})
+}
+
+func TestChecksFromC(t *testing.T) {
+	p := cgobytepool.WithChecks(cgobytepool.NewPool(
+		cgobytepool.DefaultMemoryAlignmentFunc,
+		cgobytepool.WithPoolSize(100, 4096),
+	))
+	defer p.Close()
+
+	h := cgobytepool.CgoHandle(p)
+	defer h.Release()
+
+	ptr := cFill(h, 4096, 0x7e)
+	if ptr == nil {
+		t.Fatalf("C Get returns NULL")
+	}
+	cRelease(h, ptr, 4096)
+	cRelease(h, ptr, 4096) // double put from C must not abort the process
+	cRelease(h, ptr, 100)  // unknown pointer
+
+	if st := p.Stats(); st.Allocs[0].Len != 1 {
+		t.Errorf("buffer is returned once actual=%d", st.Allocs[0].Len)
+	}
+}
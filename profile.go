@@ -0,0 +1,68 @@
+package cgobytepool
+
+import (
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// ProfileName is the name of pprof.Profile that lists sampled outstanding buffers by stack.
+const ProfileName string = "cgobytepool"
+
+var (
+	profileOnce = new(sync.Once)
+	profile     *pprof.Profile
+)
+
+// Profile returns the profile of outstanding buffers sampled by WithProfileRate.
+// It is also available from pprof.Lookup(ProfileName) and /debug/pprof/cgobytepool of net/http/pprof.
+func Profile() *pprof.Profile {
+	profileOnce.Do(func() {
+		if p := pprof.Lookup(ProfileName); p != nil {
+			profile = p
+			return
+		}
+		profile = pprof.NewProfile(ProfileName)
+	})
+	return profile
+}
+
+// profiler samples 1 in rate bytes returned by Get, like runtime.MemProfileRate.
+type profiler struct {
+	rate    int64
+	bytes   int64
+	count   int64     // sampled buffers not yet returned
+	sampled *sync.Map // map[uintptr]struct{}
+}
+
+func (s *profiler) add(ptr unsafe.Pointer, n int, skip int) {
+	next := atomic.AddInt64(&s.bytes, int64(n))
+	prev := next - int64(n)
+	if prev/s.rate == next/s.rate {
+		return // not sampled
+	}
+	s.sampled.Store(uintptr(ptr), struct{}{})
+	atomic.AddInt64(&s.count, 1)
+	Profile().Add(uintptr(ptr), skip+1)
+}
+
+func (s *profiler) remove(ptr unsafe.Pointer) {
+	if atomic.LoadInt64(&s.count) == 0 {
+		return
+	}
+	if _, ok := s.sampled.LoadAndDelete(uintptr(ptr)); ok {
+		Profile().Remove(uintptr(ptr))
+		atomic.AddInt64(&s.count, -1)
+	}
+}
+
+func newProfiler(rate int) *profiler {
+	Profile() // register
+	return &profiler{
+		rate:    int64(rate),
+		bytes:   0,
+		count:   0,
+		sampled: new(sync.Map),
+	}
+}
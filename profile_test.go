@@ -0,0 +1,89 @@
+package cgobytepool
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestProfile(t *testing.T) {
+	t.Run("registered", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithProfileRate(1))
+		defer p.Close()
+
+		if pprof.Lookup(ProfileName) != Profile() {
+			tt.Errorf("profile must be registered as %s", ProfileName)
+		}
+	})
+	t.Run("rate1", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 64), WithProfileRate(1))
+		defer p.Close()
+
+		base := Profile().Count()
+		ptrs := make([]unsafe.Pointer, 5)
+		for i := range ptrs {
+			ptrs[i] = p.Get(64)
+		}
+		if c := Profile().Count() - base; c != 5 {
+			tt.Errorf("all Get sampled expect 5 actual=%d", c)
+		}
+
+		buf := bytes.NewBuffer(nil)
+		Profile().WriteTo(buf, 1)
+		if strings.Contains(buf.String(), "TestProfile") != true {
+			tt.Errorf("stack must contain caller of Get: %s", buf.String())
+		}
+		if strings.Contains(buf.String(), "tryGet") {
+			tt.Errorf("stack must start from caller of Get: %s", buf.String())
+		}
+
+		for i := range ptrs {
+			p.Put(ptrs[i], 64)
+		}
+		if c := Profile().Count() - base; c != 0 {
+			tt.Errorf("all Put removed expect 0 actual=%d", c)
+		}
+	})
+	t.Run("sampling", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithProfileRate(64*1024))
+		defer p.Close()
+
+		base := Profile().Count()
+		size := 1024
+		n := p.alignFunc(size)
+		ptrs := make([]unsafe.Pointer, 256)
+		for i := range ptrs {
+			ptrs[i] = p.Get(size)
+		}
+		expect := (len(ptrs) * n) / (64 * 1024)
+		if c := Profile().Count() - base; c != expect {
+			tt.Errorf("1 in 64KB expect %d actual=%d", expect, c)
+		}
+		for i := range ptrs {
+			p.Put(ptrs[i], size)
+		}
+		if c := Profile().Count() - base; c != 0 {
+			tt.Errorf("all Put removed expect 0 actual=%d", c)
+		}
+	})
+	t.Run("reuse", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 64), WithProfileRate(1))
+		defer p.Close()
+
+		// same pointer sampled again after reuse must not panic
+		for i := 0; i < 10; i += 1 {
+			ptr := p.Get(64)
+			p.Put(ptr, 64)
+		}
+	})
+	t.Run("disabled", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc)
+		defer p.Close()
+
+		if p.profiler != nil {
+			tt.Errorf("profiling disabled by default")
+		}
+	})
+}
@@ -0,0 +1,138 @@
+#include <stdatomic.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+#include <time.h>
+
+#include "cgobytepool.h"
+
+// bounded queue by D. Vyukov, sequence number of each cell tells
+// whether it is ready to be written (seq == pos) or read (seq == pos + 1)
+typedef struct cgobytepool_putq_cell_t {
+  atomic_size_t seq;
+  void *data;
+  size_t size;
+  uint64_t enqueued_ns;
+} cgobytepool_putq_cell_t;
+
+struct cgobytepool_putq_t {
+  cgobytepool_putq_cell_t *cells;
+  size_t mask;
+  char pad0[64];
+  atomic_size_t enqueue_pos;
+  char pad1[64];
+  atomic_size_t dequeue_pos;
+  char pad2[64];
+  atomic_uint_fast64_t rejected;
+};
+
+static uint64_t cgobytepool_now_ns() {
+  struct timespec ts;
+  clock_gettime(CLOCK_MONOTONIC, &ts);
+  return ((uint64_t) ts.tv_sec * 1000000000) + (uint64_t) ts.tv_nsec;
+}
+
+cgobytepool_putq_t *cgobytepool_putq_new(size_t capacity) {
+  if (((SIZE_MAX >> 1) + 1) / sizeof(cgobytepool_putq_cell_t) < capacity) {
+    return NULL; // size would overflow
+  }
+  size_t size = 2;
+  while (size < capacity) {
+    size <<= 1;
+  }
+
+  cgobytepool_putq_t *q = (cgobytepool_putq_t *) malloc(sizeof(cgobytepool_putq_t));
+  if (q == NULL) {
+    return NULL;
+  }
+  memset(q, 0, sizeof(cgobytepool_putq_t));
+
+  q->cells = (cgobytepool_putq_cell_t *) malloc(sizeof(cgobytepool_putq_cell_t) * size);
+  if (q->cells == NULL) {
+    free(q);
+    return NULL;
+  }
+  for (size_t i = 0; i < size; i += 1) {
+    atomic_init(&q->cells[i].seq, i);
+  }
+  q->mask = size - 1;
+  atomic_init(&q->enqueue_pos, 0);
+  atomic_init(&q->dequeue_pos, 0);
+  atomic_init(&q->rejected, 0);
+  return q;
+}
+
+void cgobytepool_putq_free(cgobytepool_putq_t *q) {
+  if (q != NULL) {
+    free(q->cells);
+  }
+  free(q);
+}
+
+int cgobytepool_putq_enqueue(cgobytepool_putq_t *q, void *data, size_t size) {
+  size_t pos = atomic_load_explicit(&q->enqueue_pos, memory_order_relaxed);
+  for (;;) {
+    cgobytepool_putq_cell_t *cell = &q->cells[pos & q->mask];
+    size_t seq = atomic_load_explicit(&cell->seq, memory_order_acquire);
+    intptr_t diff = (intptr_t) seq - (intptr_t) pos;
+    if (diff == 0) {
+      if (atomic_compare_exchange_weak_explicit(&q->enqueue_pos, &pos, pos + 1, memory_order_relaxed, memory_order_relaxed)) {
+        cell->data = data;
+        cell->size = size;
+        cell->enqueued_ns = cgobytepool_now_ns();
+        atomic_store_explicit(&cell->seq, pos + 1, memory_order_release);
+        return 0;
+      }
+      // pos updated by CAS failure, retry
+    } else if (diff < 0) {
+      atomic_fetch_add_explicit(&q->rejected, 1, memory_order_relaxed);
+      return -1; // full
+    } else {
+      pos = atomic_load_explicit(&q->enqueue_pos, memory_order_relaxed);
+    }
+  }
+}
+
+// single consumer
+size_t cgobytepool_putq_drain(cgobytepool_putq_t *q, void **datas, size_t *sizes, size_t max, uint64_t *wait_ns_max, uint64_t *wait_ns_sum) {
+  uint64_t now = cgobytepool_now_ns();
+  size_t pos = atomic_load_explicit(&q->dequeue_pos, memory_order_relaxed);
+  size_t n = 0;
+  *wait_ns_max = 0;
+  *wait_ns_sum = 0;
+  for (; n < max; n += 1) {
+    cgobytepool_putq_cell_t *cell = &q->cells[pos & q->mask];
+    size_t seq = atomic_load_explicit(&cell->seq, memory_order_acquire);
+    if ((intptr_t) seq - (intptr_t) (pos + 1) < 0) {
+      break; // empty, or producer has not finished writing yet
+    }
+    datas[n] = cell->data;
+    sizes[n] = cell->size;
+    uint64_t wait = (cell->enqueued_ns < now) ? now - cell->enqueued_ns : 0;
+    if (*wait_ns_max < wait) {
+      *wait_ns_max = wait;
+    }
+    *wait_ns_sum += wait;
+    atomic_store_explicit(&cell->seq, pos + q->mask + 1, memory_order_release);
+    pos += 1;
+  }
+  atomic_store_explicit(&q->dequeue_pos, pos, memory_order_relaxed);
+  return n;
+}
+
+size_t cgobytepool_putq_len(cgobytepool_putq_t *q) {
+  size_t enq = atomic_load_explicit(&q->enqueue_pos, memory_order_relaxed);
+  size_t deq = atomic_load_explicit(&q->dequeue_pos, memory_order_relaxed);
+  if (enq < deq) {
+    return 0;
+  }
+  return enq - deq;
+}
+
+size_t cgobytepool_putq_cap(cgobytepool_putq_t *q) {
+  return q->mask + 1;
+}
+
+uint64_t cgobytepool_putq_rejected(cgobytepool_putq_t *q) {
+  return atomic_load_explicit(&q->rejected, memory_order_relaxed);
+}
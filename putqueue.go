@@ -0,0 +1,205 @@
+package cgobytepool
+
+/*
+#include <stdlib.h>
+#include "cgobytepool.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	defaultPutQueueDrainSize int = 256
+	maxPutQueueCapacity      int = 1 << 24
+)
+
+var (
+	ErrInvalidPutQueueCapacity = errors.New("cgobytepool: put queue capacity must be 1..16777216")
+)
+
+type PutQueueStats struct {
+	Depth    int   // buffers waiting in queue
+	Capacity int   // queue capacity
+	Drained  int64 // buffers returned to pool so far
+	Rejected int64 // enqueue failures because queue was full
+	Latency  struct {
+		Max  time.Duration // longest time a buffer waited in queue
+		Mean time.Duration // average time a buffer waited in queue
+	}
+}
+
+// PutQueue is a lock-free MPSC queue in C memory.
+// C threads return buffers with cgobytepool_putq_enqueue (declared in cgobytepool.h)
+// without crossing into Go, and Go drains them into the pool periodically or on Drain.
+//
+//	extern int cgobytepool_putq_enqueue(struct cgobytepool_putq_t *q, void *data, size_t size);
+//
+//	if (cgobytepool_putq_enqueue(q, data, size) != 0) {
+//	  bytepool_put(ctx, data, size); // queue is full
+//	}
+type PutQueue struct {
+	pool      Pool
+	q         *C.cgobytepool_putq_t
+	qmutex    *sync.RWMutex // guards q from being freed during Enqueue
+	mutex     *sync.Mutex
+	datas     *unsafe.Pointer
+	sizes     *C.size_t
+	drainSize int
+	drained   int64
+	rejected  int64 // snapshot on Close
+	waitMax   int64
+	waitSum   int64
+	once      *sync.Once
+	done      chan struct{}
+}
+
+// Pointer returns cgobytepool_putq_t* to pass to C, or nil after Close.
+func (q *PutQueue) Pointer() unsafe.Pointer {
+	q.qmutex.RLock()
+	defer q.qmutex.RUnlock()
+
+	return unsafe.Pointer(q.q)
+}
+
+// Enqueue is same as cgobytepool_putq_enqueue, it returns false if queue is full or closed.
+func (q *PutQueue) Enqueue(data unsafe.Pointer, size int) bool {
+	q.qmutex.RLock()
+	defer q.qmutex.RUnlock()
+
+	if q.q == nil {
+		return false // closed
+	}
+	return C.cgobytepool_putq_enqueue(q.q, data, C.size_t(size)) == 0
+}
+
+// Drain returns all queued buffers to pool and returns the number of buffers.
+func (q *PutQueue) Drain() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.q == nil {
+		return 0 // closed
+	}
+
+	datas := unsafe.Slice(q.datas, q.drainSize)
+	sizes := unsafe.Slice(q.sizes, q.drainSize)
+	total := 0
+	for {
+		waitMax, waitSum := C.uint64_t(0), C.uint64_t(0)
+		n := int(C.cgobytepool_putq_drain(q.q, q.datas, q.sizes, C.size_t(q.drainSize), &waitMax, &waitSum))
+		for i := 0; i < n; i += 1 {
+			q.pool.Put(datas[i], int(sizes[i]))
+		}
+		if 0 < n {
+			if atomic.LoadInt64(&q.waitMax) < int64(waitMax) {
+				atomic.StoreInt64(&q.waitMax, int64(waitMax))
+			}
+			atomic.AddInt64(&q.waitSum, int64(waitSum))
+			atomic.AddInt64(&q.drained, int64(n))
+		}
+		total += n
+		if n < q.drainSize {
+			return total
+		}
+	}
+}
+
+func (q *PutQueue) Stats() PutQueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	st := PutQueueStats{
+		Drained:  atomic.LoadInt64(&q.drained),
+		Rejected: q.rejected,
+	}
+	if q.q != nil {
+		st.Depth = int(C.cgobytepool_putq_len(q.q))
+		st.Capacity = int(C.cgobytepool_putq_cap(q.q))
+		st.Rejected = int64(C.cgobytepool_putq_rejected(q.q))
+	}
+	st.Latency.Max = time.Duration(atomic.LoadInt64(&q.waitMax))
+	if 0 < st.Drained {
+		st.Latency.Mean = time.Duration(atomic.LoadInt64(&q.waitSum) / st.Drained)
+	}
+	return st
+}
+
+func (q *PutQueue) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+			q.Drain()
+		}
+	}
+}
+
+// Start drains the queue every interval in background.
+func (q *PutQueue) Start(interval time.Duration) {
+	go q.run(interval)
+}
+
+// Close stops draining, returns remaining buffers to pool and frees the queue.
+// C must not enqueue after Close, Enqueue from Go returns false and Close can be called more than once.
+func (q *PutQueue) Close() {
+	q.once.Do(func() {
+		close(q.done)
+
+		q.qmutex.Lock()
+		defer q.qmutex.Unlock()
+
+		q.Drain() // no Enqueue from Go after this
+
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+
+		q.rejected = int64(C.cgobytepool_putq_rejected(q.q))
+		C.cgobytepool_putq_free(q.q)
+		C.free(unsafe.Pointer(q.datas))
+		C.free(unsafe.Pointer(q.sizes))
+		q.q = nil
+	})
+}
+
+// NewPutQueue creates queue of capacity (rounded up to power of 2) that returns buffers to p.
+// It returns ErrInvalidPutQueueCapacity unless 0 < capacity <= 1<<24,
+// or ErrAllocFailed if C memory of the queue cannot be allocated.
+func NewPutQueue(p Pool, capacity int) (*PutQueue, error) {
+	if capacity <= 0 || maxPutQueueCapacity < capacity {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidPutQueueCapacity, capacity)
+	}
+	drainSize := defaultPutQueueDrainSize
+	cq := C.cgobytepool_putq_new(C.size_t(capacity))
+	if cq == nil {
+		return nil, ErrAllocFailed
+	}
+	// C.malloc of cgo never returns nil, it aborts on out of memory
+	datas := (*unsafe.Pointer)(C.malloc(C.size_t(unsafe.Sizeof(unsafe.Pointer(nil))) * C.size_t(drainSize)))
+	sizes := (*C.size_t)(C.malloc(C.size_t(unsafe.Sizeof(C.size_t(0))) * C.size_t(drainSize)))
+	return &PutQueue{
+		pool:      p,
+		q:         cq,
+		qmutex:    new(sync.RWMutex),
+		mutex:     new(sync.Mutex),
+		datas:     datas,
+		sizes:     sizes,
+		drainSize: drainSize,
+		drained:   0,
+		rejected:  0,
+		waitMax:   0,
+		waitSum:   0,
+		once:      new(sync.Once),
+		done:      make(chan struct{}),
+	}, nil
+}
@@ -0,0 +1,195 @@
+package cgobytepool
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestPutQueue(t *testing.T) {
+	t.Run("Drain", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100), WithPoolSize(10, 200))
+		defer p.Close()
+
+		q, err := NewPutQueue(p, 8)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		defer q.Close()
+
+		ptr1, ptr2 := p.Get(100), p.Get(200)
+		if q.Enqueue(ptr1, 100) != true {
+			tt.Errorf("enqueue")
+		}
+		if q.Enqueue(ptr2, 200) != true {
+			tt.Errorf("enqueue")
+		}
+		if st := q.Stats(); st.Depth != 2 {
+			tt.Errorf("2 buffers queued actual=%d", st.Depth)
+		}
+		if p.OutstandingCount() != 2 {
+			tt.Errorf("not returned yet actual=%d", p.OutstandingCount())
+		}
+
+		if n := q.Drain(); n != 2 {
+			tt.Errorf("drained actual=%d", n)
+		}
+		if p.OutstandingCount() != 0 {
+			tt.Errorf("returned actual=%d", p.OutstandingCount())
+		}
+		if p.pools[0].Len() != 1 || p.pools[1].Len() != 1 {
+			tt.Errorf("returned to each size class")
+		}
+		st := q.Stats()
+		if st.Depth != 0 || st.Drained != 2 {
+			tt.Errorf("actual=%+v", st)
+		}
+	})
+	t.Run("full", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100))
+		defer p.Close()
+
+		q, err := NewPutQueue(p, 3) // rounded up to 4
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		defer q.Close()
+
+		if q.Stats().Capacity != 4 {
+			tt.Errorf("actual=%d", q.Stats().Capacity)
+		}
+		ptrs := make([]unsafe.Pointer, 5)
+		for i := range ptrs {
+			ptrs[i] = p.Get(100)
+		}
+		for i := 0; i < 4; i += 1 {
+			if q.Enqueue(ptrs[i], 100) != true {
+				tt.Errorf("enqueue %d", i)
+			}
+		}
+		if q.Enqueue(ptrs[4], 100) {
+			tt.Errorf("queue is full")
+		}
+		p.Put(ptrs[4], 100)
+		if q.Stats().Rejected != 1 {
+			tt.Errorf("actual=%d", q.Stats().Rejected)
+		}
+
+		q.Drain()
+		if q.Enqueue(p.Get(100), 100) != true {
+			tt.Errorf("enqueue after drain")
+		}
+	})
+	t.Run("concurrent", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1000, 100))
+		defer p.Close()
+
+		q, err := NewPutQueue(p, 64)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		q.Start(time.Millisecond)
+
+		wg := new(sync.WaitGroup)
+		for i := 0; i < 8; i += 1 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j += 1 {
+					ptr := p.Get(100)
+					if q.Enqueue(ptr, 100) != true {
+						p.Put(ptr, 100)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		q.Close()
+		if p.OutstandingCount() != 0 {
+			tt.Errorf("all returned actual=%d", p.OutstandingCount())
+		}
+		st := q.Stats()
+		if st.Drained+st.Rejected != 8000 {
+			tt.Errorf("drained or put synchronously actual=%+v", st)
+		}
+		tt.Logf("drained=%d rejected=%d latency=%+v", st.Drained, st.Rejected, st.Latency)
+	})
+	t.Run("invalid_capacity", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc)
+		defer p.Close()
+
+		for _, capacity := range []int{-1, 0, maxPutQueueCapacity + 1, math.MaxInt} {
+			if _, err := NewPutQueue(p, capacity); errors.Is(err, ErrInvalidPutQueueCapacity) != true {
+				tt.Errorf("capacity=%d expect ErrInvalidPutQueueCapacity actual=%+v", capacity, err)
+			}
+		}
+		q, err := NewPutQueue(p, 1)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		q.Close()
+	})
+	t.Run("closed", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 100))
+		defer p.Close()
+
+		q, err := NewPutQueue(p, 8)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		ptr := p.Get(100)
+		q.Enqueue(ptr, 100)
+		q.Close()
+		q.Close()
+
+		ptr = p.Get(100)
+		if q.Enqueue(ptr, 100) {
+			tt.Errorf("enqueue after Close must fail")
+		}
+		p.Put(ptr, 100)
+		if q.Pointer() != nil {
+			tt.Errorf("pointer is nil after Close")
+		}
+		if q.Drain() != 0 {
+			tt.Errorf("nothing to drain after Close")
+		}
+		if p.OutstandingCount() != 0 {
+			tt.Errorf("all returned actual=%d", p.OutstandingCount())
+		}
+	})
+	t.Run("close_concurrent_enqueue", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1000, 100))
+		defer p.Close()
+
+		q, err := NewPutQueue(p, 64)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		q.Start(time.Millisecond)
+
+		wg := new(sync.WaitGroup)
+		for i := 0; i < 8; i += 1 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j += 1 {
+					ptr := p.Get(100)
+					if q.Enqueue(ptr, 100) != true {
+						p.Put(ptr, 100)
+					}
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		q.Close() // while enqueueing
+		wg.Wait()
+
+		if p.OutstandingCount() != 0 {
+			tt.Errorf("all returned actual=%d", p.OutstandingCount())
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package cgobytepool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// trace file format:
+//
+//	header: magic(8) version(1) start unixnano(8, big endian)
+//	event:  op(1) delta nanoseconds(uvarint) size(uvarint) class(varint) id(uvarint) thread(uvarint)
+const (
+	traceMagic   string = "CBPTRACE"
+	traceVersion byte   = 1
+)
+
+type TraceOp byte
+
+const (
+	TraceOpGet TraceOp = 1
+	TraceOpPut TraceOp = 2
+)
+
+func (op TraceOp) String() string {
+	switch op {
+	case TraceOpGet:
+		return "Get"
+	case TraceOpPut:
+		return "Put"
+	}
+	return fmt.Sprintf("TraceOp(%d)", byte(op))
+}
+
+var (
+	ErrInvalidTrace = errors.New("cgobytepool: invalid trace")
+)
+
+// TraceEvent is a Get/Put recorded by WithRecorder.
+// ID identifies the buffer from Get to Put (ids are reused after Put), 0 if unknown.
+// Thread is the OS thread id where available, 0 otherwise.
+type TraceEvent struct {
+	Op     TraceOp
+	Time   time.Duration // since the start of the trace
+	Size   int           // requested size
+	Class  int           // size class id, FallbackClass for fallback
+	ID     uint64
+	Thread uint64
+}
+
+type recorder struct {
+	mutex  *sync.Mutex
+	w      *bufio.Writer
+	start  time.Time
+	last   time.Duration
+	ids    map[uintptr]uint64
+	free   []uint64
+	nextID uint64
+	buf    []byte
+	err    error
+}
+
+func (r *recorder) id(op TraceOp, ptr unsafe.Pointer) uint64 {
+	if op == TraceOpGet {
+		id := uint64(0)
+		if 0 < len(r.free) {
+			id = r.free[len(r.free)-1]
+			r.free = r.free[:len(r.free)-1]
+		} else {
+			r.nextID += 1
+			id = r.nextID
+		}
+		r.ids[uintptr(ptr)] = id
+		return id
+	}
+
+	id, ok := r.ids[uintptr(ptr)]
+	if ok != true {
+		return 0
+	}
+	delete(r.ids, uintptr(ptr))
+	r.free = append(r.free, id)
+	return id
+}
+
+func (r *recorder) record(op TraceOp, size, class int, ptr unsafe.Pointer) {
+	thread := threadID()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return
+	}
+	now := time.Since(r.start)
+	delta := now - r.last
+	if delta < 0 {
+		delta = 0
+	}
+	r.last += delta
+
+	b := r.buf[:0]
+	b = append(b, byte(op))
+	b = binary.AppendUvarint(b, uint64(delta))
+	b = binary.AppendUvarint(b, uint64(size))
+	b = binary.AppendVarint(b, int64(class))
+	b = binary.AppendUvarint(b, r.id(op, ptr))
+	b = binary.AppendUvarint(b, thread)
+	r.buf = b
+	if _, err := r.w.Write(b); err != nil {
+		r.err = err
+	}
+}
+
+func (r *recorder) flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.w.Flush(); err != nil {
+		r.err = err
+	}
+	return r.err
+}
+
+func newRecorder(w io.Writer) *recorder {
+	r := &recorder{
+		mutex:  new(sync.Mutex),
+		w:      bufio.NewWriter(w),
+		start:  time.Now(),
+		last:   0,
+		ids:    make(map[uintptr]uint64),
+		free:   make([]uint64, 0, 64),
+		nextID: 0,
+		buf:    make([]byte, 0, 1+binary.MaxVarintLen64*5),
+		err:    nil,
+	}
+
+	header := make([]byte, 0, len(traceMagic)+1+8)
+	header = append(header, traceMagic...)
+	header = append(header, traceVersion)
+	header = binary.BigEndian.AppendUint64(header, uint64(r.start.UnixNano()))
+	if _, err := r.w.Write(header); err != nil {
+		r.err = err
+	}
+	return r
+}
+
+// TraceReader reads events recorded by WithRecorder.
+type TraceReader struct {
+	r     *bufio.Reader
+	start time.Time
+	now   time.Duration
+}
+
+// Start returns the time when recording started.
+func (t *TraceReader) Start() time.Time {
+	return t.start
+}
+
+// Next returns the next event, or io.EOF at the end of trace.
+func (t *TraceReader) Next() (TraceEvent, error) {
+	op, err := t.r.ReadByte()
+	if err != nil {
+		return TraceEvent{}, err // io.EOF
+	}
+	if TraceOp(op) != TraceOpGet && TraceOp(op) != TraceOpPut {
+		return TraceEvent{}, fmt.Errorf("%w: unknown op %d", ErrInvalidTrace, op)
+	}
+
+	delta, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return TraceEvent{}, truncatedTrace(err)
+	}
+	size, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return TraceEvent{}, truncatedTrace(err)
+	}
+	class, err := binary.ReadVarint(t.r)
+	if err != nil {
+		return TraceEvent{}, truncatedTrace(err)
+	}
+	id, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return TraceEvent{}, truncatedTrace(err)
+	}
+	thread, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return TraceEvent{}, truncatedTrace(err)
+	}
+
+	t.now += time.Duration(delta)
+	return TraceEvent{
+		Op:     TraceOp(op),
+		Time:   t.now,
+		Size:   int(size),
+		Class:  int(class),
+		ID:     id,
+		Thread: thread,
+	}, nil
+}
+
+func truncatedTrace(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidTrace, err)
+}
+
+// NewTraceReader reads the header of trace from r.
+func NewTraceReader(r io.Reader) (*TraceReader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(traceMagic)+1+8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, truncatedTrace(err)
+	}
+	if string(header[:len(traceMagic)]) != traceMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidTrace)
+	}
+	if header[len(traceMagic)] != traceVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidTrace, header[len(traceMagic)])
+	}
+	start := int64(binary.BigEndian.Uint64(header[len(traceMagic)+1:]))
+	return &TraceReader{
+		r:     br,
+		start: time.Unix(0, start),
+		now:   0,
+	}, nil
+}
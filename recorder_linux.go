@@ -0,0 +1,9 @@
+package cgobytepool
+
+import (
+	"syscall"
+)
+
+func threadID() uint64 {
+	return uint64(syscall.Gettid())
+}
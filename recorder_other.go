@@ -0,0 +1,7 @@
+//go:build !linux
+
+package cgobytepool
+
+func threadID() uint64 {
+	return 0 // not available
+}
@@ -0,0 +1,105 @@
+package cgobytepool
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"unsafe"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Run("events", func(tt *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 64), WithRecorder(buf))
+
+		ptr1 := p.Get(10)
+		ptr2 := p.Get(1000)
+		p.Put(ptr1, 10)
+		ptr3 := p.Get(20) // reuses id of ptr1
+		p.Put(ptr3, 20)
+		p.Put(ptr2, 1000)
+		p.Close()
+
+		events, err := ReadTrace(buf)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		expect := []TraceEvent{
+			{Op: TraceOpGet, Size: 10, Class: 0, ID: 1},
+			{Op: TraceOpGet, Size: 1000, Class: FallbackClass, ID: 2},
+			{Op: TraceOpPut, Size: 10, Class: 0, ID: 1},
+			{Op: TraceOpGet, Size: 20, Class: 0, ID: 1},
+			{Op: TraceOpPut, Size: 20, Class: 0, ID: 1},
+			{Op: TraceOpPut, Size: 1000, Class: FallbackClass, ID: 2},
+		}
+		if len(events) != len(expect) {
+			tt.Fatalf("expect %d events actual=%+v", len(expect), events)
+		}
+		for i, e := range expect {
+			ev := events[i]
+			if ev.Op != e.Op || ev.Size != e.Size || ev.Class != e.Class || ev.ID != e.ID {
+				tt.Errorf("events[%d] expect %+v actual=%+v", i, e, ev)
+			}
+			if 0 < i && ev.Time < events[i-1].Time {
+				tt.Errorf("events[%d] time must be monotonic", i)
+			}
+		}
+	})
+	t.Run("flush", func(tt *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		p := NewPool(DefaultMemoryAlignmentFunc, WithRecorder(buf))
+		defer p.Close()
+
+		ptr := p.Get(10)
+		p.Put(ptr, 10)
+		if err := p.FlushTrace(); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		events, err := ReadTrace(bytes.NewReader(buf.Bytes()))
+		if err != nil || len(events) != 2 {
+			tt.Errorf("flushed events expect 2 actual=%d %+v", len(events), err)
+		}
+	})
+	t.Run("write_error", func(tt *testing.T) {
+		w := &failWriter{}
+		p := NewPool(DefaultMemoryAlignmentFunc, WithRecorder(w))
+		defer p.Close()
+
+		ptr := p.Get(10)
+		p.Put(ptr, 10)
+		if err := p.FlushTrace(); errors.Is(err, errWrite) != true {
+			tt.Errorf("expect write error actual=%+v", err)
+		}
+	})
+	t.Run("invalid", func(tt *testing.T) {
+		if _, err := NewTraceReader(bytes.NewReader([]byte("NOTTRACE\x01\x00\x00\x00\x00\x00\x00\x00\x00"))); errors.Is(err, ErrInvalidTrace) != true {
+			tt.Errorf("bad magic expect ErrInvalidTrace actual=%+v", err)
+		}
+		if _, err := NewTraceReader(bytes.NewReader([]byte("CBP"))); errors.Is(err, ErrInvalidTrace) != true {
+			tt.Errorf("short header expect ErrInvalidTrace actual=%+v", err)
+		}
+
+		buf := bytes.NewBuffer(nil)
+		r := newRecorder(buf)
+		r.record(TraceOpGet, 1000, 0, unsafe.Pointer(&buf))
+		r.flush()
+		data := buf.Bytes()
+
+		if _, err := ReadTrace(bytes.NewReader(data[:len(data)-1])); errors.Is(err, io.ErrUnexpectedEOF) != true {
+			tt.Errorf("truncated expect ErrUnexpectedEOF actual=%+v", err)
+		}
+		data[len(traceMagic)+1+8] = 0xff
+		if _, err := ReadTrace(bytes.NewReader(data)); errors.Is(err, ErrInvalidTrace) != true {
+			tt.Errorf("unknown op expect ErrInvalidTrace actual=%+v", err)
+		}
+	})
+}
+
+var errWrite = errors.New("write error")
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}
@@ -0,0 +1,109 @@
+package cgobytepool
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrDuplicateName    = errors.New("cgobytepool: duplicate pool name")
+	ErrUncomparablePool = errors.New("cgobytepool: pool is nil or not comparable")
+)
+
+type poolRegistry struct {
+	mutex *sync.Mutex
+	pools map[string]Pool
+}
+
+// isComparable reports whether p can be compared by == without panic,
+// unregister finds the registered pool by identity.
+func isComparable(p Pool) bool {
+	return reflect.ValueOf(p).Comparable()
+}
+
+func (r *poolRegistry) register(name string, p Pool) error {
+	if isComparable(p) != true {
+		return ErrUncomparablePool
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.pools[name]; ok {
+		return ErrDuplicateName
+	}
+	r.pools[name] = p
+	return nil
+}
+
+// unregister removes name only if it is still registered to p.
+func (r *poolRegistry) unregister(name string, p Pool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if curr, ok := r.pools[name]; ok && isComparable(p) && curr == p {
+		delete(r.pools, name)
+	}
+}
+
+func (r *poolRegistry) lookup(name string) (Pool, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	p, ok := r.pools[name]
+	return p, ok
+}
+
+func (r *poolRegistry) snapshot() ([]string, map[string]Pool) {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.pools))
+	pools := make(map[string]Pool, len(r.pools))
+	for name, p := range r.pools {
+		names = append(names, name)
+		pools[name] = p
+	}
+	r.mutex.Unlock()
+
+	sort.Strings(names)
+	return names, pools
+}
+
+func newPoolRegistry() *poolRegistry {
+	return &poolRegistry{
+		mutex: new(sync.Mutex),
+		pools: make(map[string]Pool),
+	}
+}
+
+var (
+	defaultPoolRegistry = newPoolRegistry()
+)
+
+// Register adds p to the global registry under name, it returns ErrDuplicateName if name is already used,
+// or ErrUncomparablePool if p is nil or its dynamic value cannot be compared (e.g. struct with map field).
+// Pools created with WithName are registered by NewPool.
+func Register(name string, p Pool) error {
+	return defaultPoolRegistry.register(name, p)
+}
+
+// Unregister removes name from the global registry if it is registered to p.
+func Unregister(name string, p Pool) {
+	defaultPoolRegistry.unregister(name, p)
+}
+
+// Lookup returns the pool registered under name.
+func Lookup(name string) (Pool, bool) {
+	return defaultPoolRegistry.lookup(name)
+}
+
+// Each calls fn for each registered pool in name order, until fn returns false.
+func Each(fn func(name string, p Pool) bool) {
+	names, pools := defaultPoolRegistry.snapshot()
+	for _, name := range names {
+		if fn(name, pools[name]) != true {
+			return
+		}
+	}
+}
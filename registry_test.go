@@ -0,0 +1,133 @@
+package cgobytepool
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type uncomparablePool struct {
+	Pool
+	tags map[string]string
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("withname", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithName("test-withname"))
+		if p.Name() != "test-withname" {
+			tt.Errorf("expect name actual=%s", p.Name())
+		}
+
+		found, ok := Lookup("test-withname")
+		if ok != true || found != Pool(p) {
+			tt.Errorf("must be registered")
+		}
+
+		p.Close()
+		if _, ok := Lookup("test-withname"); ok {
+			tt.Errorf("must be unregistered on Close")
+		}
+
+		// name is reusable after Close
+		p2 := NewPool(DefaultMemoryAlignmentFunc, WithName("test-withname"))
+		p2.Close()
+	})
+	t.Run("duplicate", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithName("test-duplicate"))
+		defer p.Close()
+
+		mustPanic(tt, "duplicate name", func() {
+			NewPool(DefaultMemoryAlignmentFunc, WithName("test-duplicate"))
+		})
+		if found, _ := Lookup("test-duplicate"); found != Pool(p) {
+			tt.Errorf("first pool must stay registered")
+		}
+		if err := Register("test-duplicate", p); errors.Is(err, ErrDuplicateName) != true {
+			tt.Errorf("expect ErrDuplicateName actual=%+v", err)
+		}
+	})
+	t.Run("register", func(tt *testing.T) {
+		inner := NewPool(DefaultMemoryAlignmentFunc)
+		defer inner.Close()
+
+		p := WithLimit(inner, 10)
+		if err := Register("test-register", p); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		Unregister("test-register", inner) // other pool does not unregister
+		if _, ok := Lookup("test-register"); ok != true {
+			tt.Errorf("must be kept")
+		}
+		Unregister("test-register", p)
+		if _, ok := Lookup("test-register"); ok {
+			tt.Errorf("must be unregistered")
+		}
+	})
+	t.Run("uncomparable", func(tt *testing.T) {
+		inner := NewPool(DefaultMemoryAlignmentFunc)
+		defer inner.Close()
+
+		p := uncomparablePool{Pool: inner, tags: map[string]string{}}
+		if err := Register("test-uncomparable", p); errors.Is(err, ErrUncomparablePool) != true {
+			tt.Errorf("expect ErrUncomparablePool actual=%+v", err)
+		}
+		if err := Register("test-uncomparable", nil); errors.Is(err, ErrUncomparablePool) != true {
+			tt.Errorf("expect ErrUncomparablePool actual=%+v", err)
+		}
+
+		if err := Register("test-uncomparable", inner); err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		defer Unregister("test-uncomparable", inner)
+
+		Unregister("test-uncomparable", p) // must not panic
+		if _, ok := Lookup("test-uncomparable"); ok != true {
+			tt.Errorf("must be kept")
+		}
+	})
+	t.Run("each", func(tt *testing.T) {
+		p1 := NewPool(DefaultMemoryAlignmentFunc, WithName("test-each-b"))
+		defer p1.Close()
+		p2 := NewPool(DefaultMemoryAlignmentFunc, WithName("test-each-a"))
+		defer p2.Close()
+
+		names := make([]string, 0)
+		Each(func(name string, p Pool) bool {
+			if strings.HasPrefix(name, "test-each-") {
+				names = append(names, name)
+			}
+			return true
+		})
+		if len(names) != 2 || names[0] != "test-each-a" || names[1] != "test-each-b" {
+			tt.Errorf("expect name order actual=%v", names)
+		}
+
+		count := 0
+		Each(func(name string, p Pool) bool {
+			count += 1
+			return false
+		})
+		if count != 1 {
+			tt.Errorf("stop iteration actual=%d", count)
+		}
+	})
+	t.Run("debughandler", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithName("test-debughandler"))
+		h := NewDebugHandler()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if strings.Contains(rec.Body.String(), "<h2>test-debughandler</h2>") != true {
+			tt.Errorf("registered pool must be listed by default: %s", rec.Body.String())
+		}
+
+		p.Close()
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if strings.Contains(rec.Body.String(), "test-debughandler") {
+			tt.Errorf("closed pool must not be listed")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package cgobytepool
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"unsafe"
+)
+
+type ReplayResult struct {
+	Gets            int64
+	Puts            int64
+	Fallbacks       int64
+	FallbackRate    float64 // Fallbacks / Gets
+	Mallocs         int64
+	Frees           int64
+	PeakBytes       int64 // peak of TotalAllocBytes
+	PeakOutstanding int64
+	Unreturned      int64 // buffers not returned by the end of trace
+}
+
+type replayObserver struct {
+	NopObserver
+	fallbacks int64
+}
+
+func (o *replayObserver) OnFallback(class int, size int, ptr unsafe.Pointer) {
+	atomic.AddInt64(&o.fallbacks, 1)
+}
+
+// ReadTrace reads all events of trace recorded by WithRecorder.
+func ReadTrace(r io.Reader) ([]TraceEvent, error) {
+	tr, err := NewTraceReader(r)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]TraceEvent, 0, 1024)
+	for {
+		ev, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return events, nil
+			}
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+}
+
+// Replay runs events against a new pool of cfg sequentially and reports its behavior.
+// Timing is not reproduced, so the scavenger of cfg is not used.
+// The warm-up profile of cfg is neither loaded nor overwritten by the replayed peaks.
+func Replay(events []TraceEvent, cfg Config) (ReplayResult, error) {
+	cfg.Name = "" // not registered
+	cfg.Scavenger.Interval = 0
+	cfg.WarmupProfile.Path = ""
+	cfg.WarmupProfile.MaxAge = 0
+
+	o := new(replayObserver)
+	p, err := NewPoolFromConfig(cfg, WithObserver(o))
+	if err != nil {
+		return ReplayResult{}, err
+	}
+	defer p.Close()
+
+	type buffer struct {
+		ptr  unsafe.Pointer
+		size int
+	}
+	buffers := make(map[uint64]buffer)
+	result := ReplayResult{}
+	for _, ev := range events {
+		switch ev.Op {
+		case TraceOpGet:
+			ptr := p.Get(ev.Size)
+			if ptr == nil {
+				return ReplayResult{}, ErrAllocFailed
+			}
+			if ev.ID == 0 {
+				p.Put(ptr, ev.Size) // unknown buffer, never returned
+				continue
+			}
+			if prev, ok := buffers[ev.ID]; ok {
+				p.Put(prev.ptr, prev.size) // missing Put
+			}
+			buffers[ev.ID] = buffer{ptr, ev.Size}
+			if b := p.TotalAllocBytes(); result.PeakBytes < b {
+				result.PeakBytes = b
+			}
+			if n := int64(len(buffers)); result.PeakOutstanding < n {
+				result.PeakOutstanding = n
+			}
+		case TraceOpPut:
+			b, ok := buffers[ev.ID]
+			if ok != true {
+				continue // taken before recording started
+			}
+			delete(buffers, ev.ID)
+			p.Put(b.ptr, b.size)
+		}
+	}
+
+	result.Unreturned = int64(len(buffers))
+	for _, b := range buffers {
+		p.Put(b.ptr, b.size)
+	}
+
+	st := p.Stats()
+	result.Gets = st.Counters.Gets
+	result.Puts = st.Counters.Puts
+	result.Mallocs = st.Counters.Mallocs
+	result.Frees = st.Counters.Frees
+	result.Fallbacks = atomic.LoadInt64(&o.fallbacks)
+	if 0 < result.Gets {
+		result.FallbackRate = float64(result.Fallbacks) / float64(result.Gets)
+	}
+	return result, nil
+}
@@ -0,0 +1,115 @@
+package cgobytepool
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestReplay(t *testing.T) {
+	// 4 concurrent buffers of 100 bytes and 1 buffer of 10000 bytes, repeated
+	events := make([]TraceEvent, 0)
+	for round := 0; round < 10; round += 1 {
+		for id := uint64(1); id <= 4; id += 1 {
+			events = append(events, TraceEvent{Op: TraceOpGet, Size: 100, ID: id})
+		}
+		events = append(events, TraceEvent{Op: TraceOpGet, Size: 10000, ID: 5})
+		for id := uint64(1); id <= 5; id += 1 {
+			size := 100
+			if id == 5 {
+				size = 10000
+			}
+			events = append(events, TraceEvent{Op: TraceOpPut, Size: size, ID: id})
+		}
+	}
+
+	t.Run("small", func(tt *testing.T) {
+		r, err := Replay(events, Config{Classes: []ClassConfig{{BufferSize: 128, PoolSize: 2}}, Alignment: 64})
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if r.Gets != 50 {
+			tt.Errorf("expect 50 gets actual=%d", r.Gets)
+		}
+		if r.Fallbacks != 10 || r.FallbackRate != 0.2 {
+			tt.Errorf("expect 10 fallbacks actual=%d rate=%f", r.Fallbacks, r.FallbackRate)
+		}
+		// first round 4 mallocs, then 2 pooled + 2 mallocs per round, plus fallback
+		if r.Mallocs != 4+9*2+10 {
+			tt.Errorf("expect %d mallocs actual=%d", 4+9*2+10, r.Mallocs)
+		}
+		if r.PeakOutstanding != 5 {
+			tt.Errorf("expect peak outstanding 5 actual=%d", r.PeakOutstanding)
+		}
+		if r.PeakBytes != 4*128+10048 {
+			tt.Errorf("expect peak %d actual=%d", 4*128+10048, r.PeakBytes)
+		}
+	})
+	t.Run("tuned", func(tt *testing.T) {
+		r, err := Replay(events, Config{Classes: []ClassConfig{{BufferSize: 128, PoolSize: 4}, {BufferSize: 10000, PoolSize: 1}}, Alignment: 64})
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if r.Fallbacks != 0 {
+			tt.Errorf("expect no fallback actual=%d", r.Fallbacks)
+		}
+		if r.Mallocs != 5 {
+			tt.Errorf("expect 5 mallocs actual=%d", r.Mallocs)
+		}
+	})
+	t.Run("unreturned", func(tt *testing.T) {
+		evs := []TraceEvent{
+			{Op: TraceOpPut, Size: 10, ID: 9}, // before recording
+			{Op: TraceOpGet, Size: 10, ID: 1},
+		}
+		r, err := Replay(evs, Config{})
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if r.Unreturned != 1 || r.Gets != 1 {
+			tt.Errorf("expect 1 unreturned actual=%+v", r)
+		}
+	})
+	t.Run("warmup_profile", func(tt *testing.T) {
+		path := filepath.Join(tt.TempDir(), "warmup.json")
+		prod := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(100, 128), WithWarmupProfile(path, 0))
+		ptrs := make([]unsafe.Pointer, 30)
+		for i := range ptrs {
+			ptrs[i] = prod.Get(128)
+		}
+		for _, ptr := range ptrs {
+			prod.Put(ptr, 128)
+		}
+		prod.Close()
+
+		before, err := os.ReadFile(path)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+
+		cfg := Config{Classes: []ClassConfig{{BufferSize: 128, PoolSize: 100}}, Alignment: 64}
+		cfg.WarmupProfile.Path = path
+		r, err := Replay(events, cfg)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if r.Mallocs != 4+10 {
+			tt.Errorf("profile must not be loaded, expect %d mallocs actual=%d", 4+10, r.Mallocs)
+		}
+
+		after, err := os.ReadFile(path)
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if bytes.Equal(before, after) != true {
+			tt.Errorf("profile must not be overwritten\nbefore=%s\nafter=%s", before, after)
+		}
+	})
+	t.Run("invalid_config", func(tt *testing.T) {
+		if _, err := Replay(events, Config{Alignment: -1}); err == nil {
+			tt.Errorf("must be error")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package cgobytepool
+
+import (
+	"sync"
+	"time"
+)
+
+type scavenger struct {
+	pools    []*cmallocPool
+	interval time.Duration
+	idleTTL  time.Duration
+	trace    bool
+	once     *sync.Once
+	done     chan struct{}
+}
+
+func (s *scavenger) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.scavenge(now)
+		}
+	}
+}
+
+func (s *scavenger) scavenge(now time.Time) int64 {
+	region := traceStartRegion(s.trace, traceRegionScavenge)
+	defer region.End()
+
+	freed := int64(0)
+	for _, pp := range s.pools {
+		freed += pp.scavengeIdle(now, s.idleTTL)
+	}
+	traceLog(s.trace, "scavenge freed=%d", freed)
+	return freed
+}
+
+func (s *scavenger) stop() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+func newScavenger(pools []*cmallocPool, interval, idleTTL time.Duration) *scavenger {
+	return &scavenger{
+		pools:    pools,
+		interval: interval,
+		idleTTL:  idleTTL,
+		trace:    false,
+		once:     new(sync.Once),
+		done:     make(chan struct{}),
+	}
+}
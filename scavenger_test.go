@@ -0,0 +1,73 @@
+package cgobytepool
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestScavenger(t *testing.T) {
+	t.Run("scavengeIdle", func(tt *testing.T) {
+		p := newCMallocPool(10, 100, defaultAllocator)
+		defer p.Close()
+
+		ptrs := make([]unsafe.Pointer, 5)
+		for i := 0; i < 5; i += 1 {
+			ptrs[i] = p.Get()
+		}
+		for i := 0; i < 5; i += 1 {
+			p.Put(ptrs[i], 100)
+		}
+		s := newScavenger([]*cmallocPool{p}, time.Second, time.Minute)
+
+		now := time.Now()
+		if freed := s.scavenge(now); freed != 0 {
+			tt.Errorf("idleTTL not elapsed, actual=%d", freed)
+		}
+
+		// first window: lowWater is not observed yet
+		now = now.Add(2 * time.Minute)
+		s.scavenge(now)
+		if p.Len() != 5 {
+			tt.Errorf("first window keeps buffers, actual=%d", p.Len())
+		}
+
+		// 2 buffers in use during this window, 3 buffers stay idle
+		ptr1, ptr2 := p.Get(), p.Get()
+		p.Put(ptr1, 100)
+		p.Put(ptr2, 100)
+
+		now = now.Add(2 * time.Minute)
+		if freed := s.scavenge(now); freed != 300 {
+			tt.Errorf("3 idle buffers released, actual=%d", freed)
+		}
+		if p.Len() != 2 {
+			tt.Errorf("2 buffers remain, actual=%d", p.Len())
+		}
+		if p.AllocBytes() != 200 {
+			tt.Errorf("2 buffers remain, actual=%d", p.AllocBytes())
+		}
+	})
+	t.Run("background", func(tt *testing.T) {
+		p := NewPool(
+			DefaultMemoryAlignmentFunc,
+			WithPoolSize(10, 100),
+			WithScavenger(10*time.Millisecond, 10*time.Millisecond),
+		)
+		defer p.Close()
+
+		ptr := p.Get(100)
+		p.Put(ptr, 100)
+		if p.TotalAllocBytes() != 352 {
+			tt.Errorf("1 buffer idle, actual=%d", p.TotalAllocBytes())
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for 0 < p.TotalAllocBytes() {
+			if deadline.Before(time.Now()) {
+				tt.Fatalf("idle buffer not released, actual=%d", p.TotalAllocBytes())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
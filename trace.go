@@ -0,0 +1,46 @@
+package cgobytepool
+
+import (
+	"context"
+	"fmt"
+	"runtime/trace"
+)
+
+// runtime/trace categories and region types
+const (
+	traceCategory       string = "cgobytepool"
+	traceRegionFallback string = "cgobytepool.fallback"
+	traceRegionMiss     string = "cgobytepool.freelist_miss"
+	traceRegionWait     string = "cgobytepool.CloseWait"
+	traceRegionScavenge string = "cgobytepool.scavenge"
+	traceRegionGet      string = "cgobytepool.Get"
+	traceRegionPut      string = "cgobytepool.Put"
+)
+
+var (
+	traceContext = context.Background()
+)
+
+// traceRegion is no-op unless enabled by WithRuntimeTrace and trace is running.
+type traceRegion struct {
+	r *trace.Region
+}
+
+func (r traceRegion) End() {
+	if r.r != nil {
+		r.r.End()
+	}
+}
+
+func traceStartRegion(enabled bool, regionType string) traceRegion {
+	if enabled && trace.IsEnabled() {
+		return traceRegion{trace.StartRegion(traceContext, regionType)}
+	}
+	return traceRegion{nil}
+}
+
+func traceLog(enabled bool, format string, args ...any) {
+	if enabled && trace.IsEnabled() {
+		trace.Log(traceContext, traceCategory, fmt.Sprintf(format, args...))
+	}
+}
@@ -0,0 +1,71 @@
+package cgobytepool
+
+import (
+	"bytes"
+	"context"
+	"runtime/trace"
+	"testing"
+	"time"
+)
+
+func TestRuntimeTrace(t *testing.T) {
+	run := func(tt *testing.T, enabled bool) []byte {
+		funcs := []WithPoolFunc{WithPoolSize(1, 64)}
+		if enabled {
+			funcs = append(funcs, WithRuntimeTrace())
+		}
+		p := NewPool(DefaultMemoryAlignmentFunc, funcs...)
+
+		buf := bytes.NewBuffer(nil)
+		if err := trace.Start(buf); err != nil {
+			tt.Skipf("trace already running: %+v", err)
+		}
+		ptr1 := p.Get(64)   // freelist miss
+		ptr2 := p.Get(64)   // freelist miss
+		ptr3 := p.Get(1024) // fallback
+		p.Put(ptr1, 64)
+		p.Put(ptr2, 64) // overflow
+		p.Put(ptr3, 1024)
+		p.scavenger = newScavenger(p.pools, time.Second, 0)
+		p.scavenger.trace = enabled
+		p.scavenger.scavenge(time.Now().Add(time.Hour))
+		p.CloseWait(context.Background())
+		trace.Stop()
+		return buf.Bytes()
+	}
+
+	events := []string{
+		traceRegionFallback,
+		traceRegionMiss,
+		traceRegionWait,
+		traceRegionScavenge,
+		"freelist miss",
+		"overflow free",
+		"fallback size",
+		"scavenge freed",
+	}
+	t.Run("enabled", func(tt *testing.T) {
+		data := run(tt, true)
+		for _, e := range events {
+			if bytes.Contains(data, []byte(e)) != true {
+				tt.Errorf("trace must contain %s", e)
+			}
+		}
+	})
+	t.Run("disabled", func(tt *testing.T) {
+		data := run(tt, false)
+		for _, e := range events {
+			if bytes.Contains(data, []byte(e)) {
+				tt.Errorf("trace must not contain %s", e)
+			}
+		}
+	})
+	t.Run("notrace", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(1, 64), WithRuntimeTrace())
+		defer p.Close()
+
+		// enabled option without running trace must not emit or panic
+		ptr := p.Get(1024)
+		p.Put(ptr, 1024)
+	})
+}
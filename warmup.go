@@ -0,0 +1,125 @@
+package cgobytepool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	warmupProfileVersion int = 1
+)
+
+var (
+	ErrStaleWarmupProfile = errors.New("cgobytepool: stale warmup profile")
+)
+
+type warmupClass struct {
+	BufferSize int   `json:"buffer_size"`
+	Peak       int64 `json:"peak"` // peak outstanding buffers
+}
+
+type warmupProfile struct {
+	Version int           `json:"version"`
+	SavedAt time.Time     `json:"saved_at"`
+	Classes []warmupClass `json:"classes"`
+}
+
+func loadWarmupProfile(path string, maxAge time.Duration, now time.Time) (warmupProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return warmupProfile{}, err
+	}
+	wp := warmupProfile{}
+	if err := json.Unmarshal(data, &wp); err != nil {
+		return warmupProfile{}, fmt.Errorf("cgobytepool: decode warmup profile %s: %w", path, err)
+	}
+	if wp.Version != warmupProfileVersion {
+		return warmupProfile{}, fmt.Errorf("cgobytepool: unsupported warmup profile version %d", wp.Version)
+	}
+	if 0 < maxAge && maxAge < now.Sub(wp.SavedAt) {
+		return warmupProfile{}, fmt.Errorf("%w: saved at %s", ErrStaleWarmupProfile, wp.SavedAt)
+	}
+	return wp, nil
+}
+
+// saveWarmupProfile writes to temporary file and renames it, so that readers never see partial profile.
+func saveWarmupProfile(path string, wp warmupProfile) error {
+	data, err := json.Marshal(wp)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (p *CgoBytePool) loadWarmupProfile(path string, maxAge time.Duration) (warmupProfile, error) {
+	if path == "" {
+		return warmupProfile{}, os.ErrNotExist
+	}
+	return loadWarmupProfile(path, maxAge, time.Now())
+}
+
+func (p *CgoBytePool) warmupProfile(now time.Time) warmupProfile {
+	classes := make([]warmupClass, len(p.pools))
+	for i, pp := range p.pools {
+		// decay the loaded peak, so that a short run does not discard the profile
+		peak := pp.Peak()
+		if peak < pp.loadedPeak/2 {
+			peak = pp.loadedPeak / 2
+		}
+		classes[i] = warmupClass{
+			BufferSize: pp.bufSize,
+			Peak:       peak,
+		}
+	}
+	return warmupProfile{
+		Version: warmupProfileVersion,
+		SavedAt: now,
+		Classes: classes,
+	}
+}
+
+// warmFromProfile warms each class with the peak recorded in wp, classes of other buffer sizes
+// in wp are ignored. Classes missing in wp are warmed by prealloc instead.
+func (p *CgoBytePool) warmFromProfile(wp warmupProfile, prealloc []optPoolSize) {
+	profiled := make(map[int]bool, len(wp.Classes))
+	for _, c := range wp.Classes {
+		for _, pp := range p.pools {
+			if pp.bufSize == c.BufferSize {
+				pp.loadedPeak = c.Peak
+				pp.warm(int(c.Peak), p.prefault)
+				profiled[pp.bufSize] = true
+			}
+		}
+	}
+	for _, s := range prealloc {
+		if pp, ok := p.find(p.alignFunc(s.bufferSize)); ok && profiled[pp.bufSize] != true {
+			pp.warm(s.poolSize, p.prefault)
+		}
+	}
+}
+
+// SaveWarmupProfile writes the peak outstanding buffers per class to the file of WithWarmupProfile.
+// It is called by Close, and can be called periodically to survive crashes.
+func (p *CgoBytePool) SaveWarmupProfile() error {
+	if p.warmupPath == "" {
+		return nil
+	}
+	return saveWarmupProfile(p.warmupPath, p.warmupProfile(time.Now()))
+}
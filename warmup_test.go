@@ -0,0 +1,170 @@
+package cgobytepool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestWarmupProfile(t *testing.T) {
+	newPool := func(path string, maxAge time.Duration) *CgoBytePool {
+		return NewPool(func(n int) int { return n },
+			WithPoolSize(100, 512),
+			WithPoolSize(100, 4096),
+			WithPrealloc(2, 512),
+			WithWarmupProfile(path, maxAge),
+		)
+	}
+	use := func(p *CgoBytePool, size, n int) {
+		ptrs := make([]unsafe.Pointer, n)
+		for i := range ptrs {
+			ptrs[i] = p.Get(size)
+		}
+		for i := range ptrs {
+			p.Put(ptrs[i], size)
+		}
+	}
+
+	t.Run("missing", func(tt *testing.T) {
+		path := filepath.Join(tt.TempDir(), "warmup.json")
+		p := newPool(path, 0)
+		if p.pools[0].Len() != 2 || p.pools[1].Len() != 0 {
+			tt.Errorf("fallback to prealloc actual=%d,%d", p.pools[0].Len(), p.pools[1].Len())
+		}
+		p.Close()
+
+		if _, err := os.Stat(path); err != nil {
+			tt.Errorf("saved on Close: %+v", err)
+		}
+	})
+	t.Run("restart", func(tt *testing.T) {
+		path := filepath.Join(tt.TempDir(), "warmup.json")
+		p := newPool(path, time.Hour)
+		use(p, 512, 30)
+		use(p, 4096, 7)
+		p.Close()
+
+		p2 := newPool(path, time.Hour)
+		defer p2.Close()
+
+		if p2.pools[0].Len() != 30 || p2.pools[1].Len() != 7 {
+			tt.Errorf("warmed by profile expect 30,7 actual=%d,%d", p2.pools[0].Len(), p2.pools[1].Len())
+		}
+		mallocs := p2.Stats().Counters.Mallocs
+		use(p2, 512, 30)
+		if m := p2.Stats().Counters.Mallocs; m != mallocs {
+			tt.Errorf("no malloc for the same workload actual=%d", m-mallocs)
+		}
+	})
+	t.Run("decay", func(tt *testing.T) {
+		path := filepath.Join(tt.TempDir(), "warmup.json")
+		p := newPool(path, 0)
+		use(p, 512, 40)
+		p.Close()
+
+		p2 := newPool(path, 0)
+		use(p2, 512, 5) // short run
+		p2.Close()
+
+		wp, err := loadWarmupProfile(path, 0, time.Now())
+		if err != nil {
+			tt.Fatalf("no error: %+v", err)
+		}
+		if wp.Classes[0].Peak != 20 {
+			tt.Errorf("short run saves half of loaded peak expect 20 actual=%d", wp.Classes[0].Peak)
+		}
+
+		p3 := newPool(path, 0)
+		use(p3, 512, 30) // higher than decayed peak
+		p3.Close()
+
+		wp, _ = loadWarmupProfile(path, 0, time.Now())
+		if wp.Classes[0].Peak != 30 {
+			tt.Errorf("observed peak expect 30 actual=%d", wp.Classes[0].Peak)
+		}
+	})
+	t.Run("stale", func(tt *testing.T) {
+		path := filepath.Join(tt.TempDir(), "warmup.json")
+		wp := warmupProfile{
+			Version: warmupProfileVersion,
+			SavedAt: time.Now().Add(-2 * time.Hour),
+			Classes: []warmupClass{{BufferSize: 4096, Peak: 10}},
+		}
+		if err := saveWarmupProfile(path, wp); err != nil {
+			tt.Fatalf("%+v", err)
+		}
+		if _, err := loadWarmupProfile(path, time.Hour, time.Now()); errors.Is(err, ErrStaleWarmupProfile) != true {
+			tt.Errorf("expect ErrStaleWarmupProfile actual=%+v", err)
+		}
+
+		p := newPool(path, time.Hour)
+		defer p.Close()
+
+		if p.pools[0].Len() != 2 || p.pools[1].Len() != 0 {
+			tt.Errorf("stale profile falls back to prealloc actual=%d,%d", p.pools[0].Len(), p.pools[1].Len())
+		}
+	})
+	t.Run("invalid", func(tt *testing.T) {
+		path := filepath.Join(tt.TempDir(), "warmup.json")
+		os.WriteFile(path, []byte("{broken"), 0644)
+
+		p := newPool(path, 0)
+		defer p.Close()
+
+		if p.pools[0].Len() != 2 {
+			tt.Errorf("invalid profile falls back to prealloc actual=%d", p.pools[0].Len())
+		}
+
+		os.WriteFile(path, []byte(`{"version":99}`), 0644)
+		if _, err := loadWarmupProfile(path, 0, time.Now()); err == nil {
+			tt.Errorf("unknown version must be error")
+		}
+	})
+	t.Run("unknown_class", func(tt *testing.T) {
+		path := filepath.Join(tt.TempDir(), "warmup.json")
+		saveWarmupProfile(path, warmupProfile{
+			Version: warmupProfileVersion,
+			SavedAt: time.Now(),
+			Classes: []warmupClass{{BufferSize: 1024, Peak: 10}, {BufferSize: 4096, Peak: 3}},
+		})
+
+		p := newPool(path, 0)
+		defer p.Close()
+
+		if p.pools[0].Len() != 2 || p.pools[1].Len() != 3 {
+			tt.Errorf("matching class is warmed by profile, others by prealloc actual=%d,%d", p.pools[0].Len(), p.pools[1].Len())
+		}
+	})
+	t.Run("new_class", func(tt *testing.T) {
+		path := filepath.Join(tt.TempDir(), "warmup.json")
+		saveWarmupProfile(path, warmupProfile{
+			Version: warmupProfileVersion,
+			SavedAt: time.Now(),
+			Classes: []warmupClass{{BufferSize: 512, Peak: 10}},
+		})
+
+		p := NewPool(func(n int) int { return n },
+			WithPoolSize(100, 512),
+			WithPoolSize(100, 4096), // added after the profile was saved
+			WithPrealloc(2, 512),
+			WithPrealloc(5, 4096),
+			WithWarmupProfile(path, 0),
+		)
+		defer p.Close()
+
+		if p.pools[0].Len() != 10 || p.pools[1].Len() != 5 {
+			tt.Errorf("expect profile peak 10, prealloc 5 actual=%d,%d", p.pools[0].Len(), p.pools[1].Len())
+		}
+	})
+	t.Run("disabled", func(tt *testing.T) {
+		p := NewPool(DefaultMemoryAlignmentFunc, WithPoolSize(10, 512))
+		defer p.Close()
+
+		if err := p.SaveWarmupProfile(); err != nil {
+			tt.Errorf("no profile no error: %+v", err)
+		}
+	})
+}